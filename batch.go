@@ -0,0 +1,84 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+	"net/smtp"
+	"strings"
+)
+
+// BatchFailure is a batch of recipients that SendBatched could not send to.
+type BatchFailure struct {
+	Recipients []string
+	Err        error
+}
+
+// BatchError is returned by SendBatched when some of the batches failed.
+type BatchError []BatchFailure
+
+func (e BatchError) Error() string {
+	s := make([]string, len(e))
+	for i, f := range e {
+		s[i] = fmt.Sprintf("%s: %v", strings.Join(f.Recipients, ","), f.Err)
+	}
+	return fmt.Sprintf("%d batches failed: %s", len(e), strings.Join(s, "; "))
+}
+
+// SendBatched sends m once for each batch of up to batchSize recipients
+// over a single connection, for relays that limit the recipients of a
+// message. The To and Cc headers of each copy only list the recipients of
+// its batch. If some batches fail the rest are still sent and a BatchError
+// is returned.
+func SendBatched(addr string, auth smtp.Auth, m *Message, batchSize int, skipverify bool) error {
+	if batchSize <= 0 {
+		return errors.New("email: batch size must be positive")
+	}
+
+	c := NewClient(addr, auth, skipverify)
+	defer c.Close()
+
+	var failed BatchError
+	for _, batch := range m.batches(batchSize) {
+		if err := c.Send(batch); err != nil {
+			failed = append(failed, BatchFailure{Recipients: batch.Tolist(), Err: err})
+		}
+		batch.RemoveSpooled()
+	}
+
+	if len(failed) > 0 {
+		return failed
+	}
+	return nil
+}
+
+// batches splits m in copies with up to size recipients each.
+func (m *Message) batches(size int) []*Message {
+	var batches []*Message
+	var batch *Message
+	n := 0
+
+	next := func() *Message {
+		if batch == nil || n == size {
+			batch = m.Clone()
+			batch.To, batch.Cc, batch.Bcc = nil, nil, nil
+			batches = append(batches, batch)
+			n = 0
+		}
+		n++
+		return batch
+	}
+	for _, to := range m.To {
+		b := next()
+		b.To = append(b.To, to)
+	}
+	for _, cc := range m.Cc {
+		b := next()
+		b.Cc = append(b.Cc, cc)
+	}
+	for _, bcc := range m.Bcc {
+		b := next()
+		b.Bcc = append(b.Bcc, bcc)
+	}
+
+	return batches
+}
@@ -0,0 +1,56 @@
+package email
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSendBatched(t *testing.T) {
+	s := newTestServer(t)
+	s.reply = func(cmd string) string {
+		if cmd == "RCPT TO:<bad@example.com>" {
+			return "550 5.1.1 No such user"
+		}
+		return ""
+	}
+
+	m := NewMessage("Hi", "this is the body")
+	m.From = "from@example.com"
+	m.To = []string{"to1@example.com", "to2@example.com", "to3@example.com"}
+	m.Cc = []string{"bad@example.com"}
+	m.Bcc = []string{"bcc@example.com"}
+
+	err := SendBatched(s.Addr(), nil, m, 2, false)
+
+	berr, ok := err.(BatchError)
+	if !ok || len(berr) != 1 || strings.Join(berr[0].Recipients, ",") != "to3@example.com,bad@example.com" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	msgs := s.Messages()
+	if len(msgs) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(msgs))
+	}
+	if !strings.Contains(msgs[0], "To: to1@example.com,to2@example.com\n") {
+		t.Fatalf("unexpected headers of the first batch:\n%s", msgs[0])
+	}
+	if strings.Contains(msgs[1], "To:  ") || strings.Contains(msgs[1], "to1@") || strings.Contains(msgs[1], "bcc@") {
+		t.Fatalf("unexpected headers of the last batch:\n%s", msgs[1])
+	}
+
+	ehlo := 0
+	for _, cmd := range s.Commands() {
+		if strings.HasPrefix(cmd, "EHLO") {
+			ehlo++
+		}
+	}
+	if ehlo != 1 {
+		t.Fatalf("expected a single connection, got %d", ehlo)
+	}
+}
+
+func TestSendBatchedInvalidSize(t *testing.T) {
+	if err := SendBatched("127.0.0.1:0", nil, NewMessage("Hi", ""), 0, false); err == nil {
+		t.Fatal("expected an error for a zero batch size")
+	}
+}
@@ -0,0 +1,99 @@
+package email
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+)
+
+// charset returns the charset of the message in lower case.
+func (m *Message) charset() string {
+	if m.Charset == "" {
+		return "utf-8"
+	}
+	return strings.ToLower(m.Charset)
+}
+
+// transcode returns the UTF-8 string s in the charset of the message.
+func (m *Message) transcode(s string) string {
+	var max rune
+	switch m.charset() {
+	case "iso-8859-1", "latin1":
+		max = 0xff
+	case "us-ascii":
+		max = 0x7f
+	default:
+		return s
+	}
+
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > max {
+			r = '?'
+		}
+		b = append(b, byte(r))
+	}
+	return string(b)
+}
+
+// decodeCharset returns the text data in charset as UTF-8. The charsets
+// supported by Message.Charset are supported.
+func decodeCharset(charset string, data []byte) (string, error) {
+	switch strings.ToLower(charset) {
+	case "", "utf-8", "us-ascii":
+		return string(data), nil
+	case "iso-8859-1", "latin1":
+		r := make([]rune, len(data))
+		for i, c := range data {
+			r[i] = rune(c)
+		}
+		return string(r), nil
+	}
+	return "", fmt.Errorf("email: unsupported charset %s", charset)
+}
+
+// encodeWord returns s as an RFC 2047 encoded word in the charset of the
+// message if it is not printable ASCII. The Q encoding, readable for
+// mostly ASCII text, is used unless the B encoding is shorter.
+func (m *Message) encodeWord(s string) string {
+	if isPrintableASCII(s) {
+		return s
+	}
+	s = m.transcode(s)
+	q := mime.QEncoding.Encode(m.charset(), s)
+	if b := mime.BEncoding.Encode(m.charset(), s); len(b) < len(q) {
+		return b
+	}
+	return q
+}
+
+// filenameParam returns the filename parameter of a Content-Disposition,
+// encoded in the charset of the message as in RFC 2231 if it is not
+// printable ASCII.
+func (m *Message) filenameParam(filename string) string {
+	if isPrintableASCII(filename) && !strings.ContainsAny(filename, `"\`) {
+		return `filename="` + filename + `"`
+	}
+
+	var b strings.Builder
+	b.WriteString("filename*=" + m.charset() + "''")
+	s := m.transcode(filename)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c > ' ' && c < 0x7f && !strings.ContainsRune(`*'%()<>@,;:\"/[]?=`, rune(c)) {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func isPrintableASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < ' ' || s[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
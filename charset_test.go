@@ -0,0 +1,89 @@
+package email
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCharset(t *testing.T) {
+	m := NewMessage("Café", "Crème brûlée €")
+	m.Charset = "ISO-8859-1"
+	m.Attachments["résumé.pdf"] = &Attachment{Filename: "résumé.pdf", Data: []byte("pdf"), Description: "Mon résumé"}
+
+	data := string(m.Bytes())
+	for _, want := range []string{
+		"Subject: =?iso-8859-1?q?Caf=E9?=\r\n",
+		"Content-Type: text/plain; charset=iso-8859-1\r\nContent-Transfer-Encoding: 8bit\r\n\r\nCr\xe8me br\xfbl\xe9e ?\r\n",
+		"Content-Disposition: attachment; filename*=iso-8859-1''r%E9sum%E9.pdf\r\n",
+		"Content-Description: =?iso-8859-1?q?Mon_r=E9sum=E9?=\r\n",
+	} {
+		if !strings.Contains(data, want) {
+			t.Fatalf("missing %q in:\n%s", want, data)
+		}
+	}
+
+	m.Charset = ""
+	data = string(m.Bytes())
+	for _, want := range []string{
+		"Subject: =?utf-8?b?Q2Fmw6k=?=\r\n",
+		"Content-Disposition: attachment; filename*=utf-8''r%C3%A9sum%C3%A9.pdf\r\n",
+	} {
+		if !strings.Contains(data, want) {
+			t.Fatalf("missing %q in:\n%s", want, data)
+		}
+	}
+}
+
+func TestCharsetValidate(t *testing.T) {
+	m := NewMessage("Hi", "Crème brûlée")
+	m.From = "from@example.com"
+	m.To = []string{"to@example.com"}
+	for _, charset := range []string{"", "UTF-8", "iso-8859-1", "latin1", "US-ASCII"} {
+		m.Charset = charset
+		if err := m.Validate(); err != nil {
+			t.Fatalf("charset %q: %v", charset, err)
+		}
+	}
+	for _, charset := range []string{"windows-1252", "shift_jis", "utf8"} {
+		m.Charset = charset
+		if err := m.Validate(); err == nil {
+			t.Fatalf("expected an error for the charset %q", charset)
+		}
+	}
+}
+
+func TestEncodeWord(t *testing.T) {
+	m := NewMessage("", "")
+	for s, want := range map[string]string{
+		"Hello":               "Hello",
+		"Café au lait":        "=?utf-8?q?Caf=C3=A9_au_lait?=",
+		"日本語のメール":             "=?utf-8?b?5pel5pys6Kqe44Gu44Oh44O844Or?=",
+		"Привет, как дела?":   "=?utf-8?b?0J/RgNC40LLQtdGCLCDQutCw0Log0LTQtdC70LA/?=",
+		"Re: Ünïcödé sübjéct": "=?utf-8?b?UmU6IMOcbsOvY8O2ZMOpIHPDvGJqw6ljdA==?=",
+	} {
+		if got := m.encodeWord(s); got != want {
+			t.Errorf("encodeWord(%q) = %q, want %q", s, got, want)
+		}
+	}
+}
+
+func TestBodyCharset(t *testing.T) {
+	for _, tt := range []struct {
+		contentType string
+		omit        bool
+		want        string
+	}{
+		{"application/json", false, "Content-Type: application/json\r\n"},
+		{"application/json; charset=utf-8", false, "Content-Type: application/json; charset=utf-8\r\n"},
+		{"text/plain", false, "Content-Type: text/plain; charset=utf-8\r\n"},
+		{"text/plain", true, "Content-Type: text/plain\r\n"},
+		{"text/calendar; charset=us-ascii", false, "Content-Type: text/calendar; charset=us-ascii\r\n"},
+	} {
+		m := NewMessage("Hi", `{"order": 1234}`)
+		m.BodyContentType = tt.contentType
+		m.OmitCharset = tt.omit
+		if h := string(m.Headers()); !strings.Contains(h, tt.want) {
+			t.Fatalf("missing %q in:\n%s", tt.want, h)
+		}
+	}
+}
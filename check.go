@@ -0,0 +1,153 @@
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+)
+
+// SelfCheck serializes the message and parses it back, checking that all
+// the parts can be walked, that the boundaries are closed and that the
+// encoded parts can be decoded. It returns a descriptive error if the
+// message would be malformed. Note that BodyReader is consumed.
+func (m *Message) SelfCheck() error {
+	var b bytes.Buffer
+	if _, err := m.WriteTo(&b); err != nil {
+		return err
+	}
+	return checkMessage(b.Bytes())
+}
+
+func checkMessage(data []byte) error {
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("email: invalid message: %v", err)
+	}
+	return checkPart("message", textproto.MIMEHeader(msg.Header), msg.Body)
+}
+
+func checkPart(name string, h textproto.MIMEHeader, body io.Reader) error {
+	contentType := h.Get("Content-Type")
+	if contentType == "" {
+		contentType = "text/plain"
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("email: %s: invalid Content-Type %q: %v", name, contentType, err)
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		if params["boundary"] == "" {
+			return fmt.Errorf("email: %s: missing boundary", name)
+		}
+		r := multipart.NewReader(body, params["boundary"])
+		for i := 1; ; i++ {
+			p, err := r.NextRawPart()
+			if err == io.EOF {
+				if i == 1 {
+					return fmt.Errorf("email: %s: no parts", name)
+				}
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("email: %s: part %d: %v", name, i, err)
+			}
+			if err := checkPart(fmt.Sprintf("%s part %d", name, i), p.Header, p); err != nil {
+				return err
+			}
+		}
+	}
+
+	switch cte := strings.ToLower(h.Get("Content-Transfer-Encoding")); cte {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "", "7bit", "8bit", "binary":
+	default:
+		return fmt.Errorf("email: %s: unknown Content-Transfer-Encoding %q", name, cte)
+	}
+	if _, err := io.Copy(ioutil.Discard, body); err != nil {
+		return fmt.Errorf("email: %s: %v", name, err)
+	}
+	return nil
+}
+
+// checkStrict checks the rules enforced by Message.Strict:
+//
+//   - the lines end with CRLF, without bare CR or LF (RFC 5322, 2.3)
+//   - the lines are at most 998 characters long (RFC 5322, 2.1.1)
+//   - the From and Date headers are present and not empty (RFC 5322, 3.6)
+//   - the headers are printable ASCII (RFC 5322, 2.2)
+//   - the parts without encoding, or encoded with quoted-printable or
+//     base64, are ASCII, and the 8bit parts have no NUL (RFC 2045, 2.7
+//     and 2.8)
+func checkStrict(data []byte) error {
+	lines := bytes.Split(data, []byte("\r\n"))
+	for i, l := range lines {
+		if bytes.IndexAny(l, "\r\n") >= 0 {
+			return fmt.Errorf("email: strict: bare CR or LF in line %d", i+1)
+		}
+		if len(l) > 998 {
+			return fmt.Errorf("email: strict: line %d longer than 998 characters", i+1)
+		}
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("email: strict: invalid message: %v", err)
+	}
+	for _, name := range []string{"From", "Date"} {
+		if msg.Header.Get(name) == "" {
+			return fmt.Errorf("email: strict: missing %s header", name)
+		}
+	}
+	return checkStrictPart("message", textproto.MIMEHeader(msg.Header), msg.Body)
+}
+
+func checkStrictPart(name string, h textproto.MIMEHeader, body io.Reader) error {
+	for k, values := range h {
+		for _, v := range values {
+			if !isPrintableASCII(strings.Replace(v, "\t", " ", -1)) {
+				return fmt.Errorf("email: strict: %s: %s header is not ASCII", name, k)
+			}
+		}
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	if strings.HasPrefix(mediaType, "multipart/") {
+		r := multipart.NewReader(body, params["boundary"])
+		for i := 1; ; i++ {
+			p, err := r.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("email: strict: %s part %d: %v", name, i, err)
+			}
+			if err := checkStrictPart(fmt.Sprintf("%s part %d", name, i), p.Header, p); err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return fmt.Errorf("email: strict: %s: %v", name, err)
+	}
+	cte := strings.ToLower(h.Get("Content-Transfer-Encoding"))
+	for _, c := range data {
+		if c == 0 || c > 0x7f && cte != "8bit" {
+			return fmt.Errorf("email: strict: %s: invalid character %#x for the %q encoding", name, c, cte)
+		}
+	}
+	return nil
+}
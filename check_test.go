@@ -0,0 +1,87 @@
+package email
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSelfCheck(t *testing.T) {
+	m := NewHTMLMessage("Hi", "<p>this is the body</p>")
+	m.AutoPlainText = true
+	m.From = "from@example.com"
+	m.To = []string{"to@example.com"}
+	m.Attachments["a.bin"] = &Attachment{Filename: "a.bin", Data: make([]byte, 1000)}
+	m.Attachments["logo.png"] = &Attachment{Filename: "logo.png", Data: []byte("png"), Inline: true, ContentType: "image/png", ContentID: "logo"}
+
+	if err := m.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckMessage(t *testing.T) {
+	header := "From: from@example.com\r\nMIME-Version: 1.0\r\n"
+	tests := []struct {
+		data string
+		err  string
+	}{
+		{header + "Content-Type: multipart/mixed; boundary=b\r\n\r\n--b\r\n\r\ntext\r\n--b\r\n\r\nunclosed",
+			"part 2"},
+		{header + "Content-Type: multipart/mixed; boundary=b\r\n\r\n--b\r\n" +
+			"Content-Transfer-Encoding: base64\r\n\r\nnot base64!\r\n--b--\r\n",
+			"message part 1: illegal base64 data"},
+		{header + "Content-Type: multipart/mixed\r\n\r\n", "missing boundary"},
+		{header + "Content-Type: text/plain\r\nContent-Transfer-Encoding: x-unknown\r\n\r\ntext",
+			"unknown Content-Transfer-Encoding"},
+	}
+
+	for _, tt := range tests {
+		err := checkMessage([]byte(tt.data))
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("expected an error with %q, got %v", tt.err, err)
+		}
+	}
+}
+
+func TestStrict(t *testing.T) {
+	newMessage := func() *Message {
+		m := NewMessage("Hi", "this is the body")
+		m.From = "from@example.com"
+		m.To = []string{"to@example.com"}
+		m.Attachments["a.txt"] = &Attachment{Filename: "a.txt", Data: []byte("attachment")}
+		m.Strict = true
+		return m
+	}
+
+	var b bytes.Buffer
+	if _, err := newMessage().WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		modify func(m *Message)
+		err    string
+	}{
+		{"bare LF", func(m *Message) { m.Body = "line\nline" }, "bare CR or LF"},
+		{"long line", func(m *Message) { m.Body, m.BodyEncoding = strings.Repeat("a", 999), "7bit" }, "longer than 998"},
+		{"missing From", func(m *Message) { m.From = "" }, "missing From"},
+		{"non-ASCII header", func(m *Message) { m.ExtraHeaders = []Header{{"X-Name", "José"}} }, "X-Name header is not ASCII"},
+		{"8-bit in 7bit part", func(m *Message) { m.Body, m.BodyEncoding = "café", "7bit" }, "invalid character 0xc3"},
+		{"NUL in 8bit part", func(m *Message) { m.Body = "café\x00" }, "invalid character 0x0"},
+	} {
+		m := newMessage()
+		tt.modify(m)
+		var b bytes.Buffer
+		_, err := m.WriteTo(&b)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Fatalf("%s: unexpected error %v", tt.name, err)
+		}
+		if b.Len() > 0 {
+			t.Fatalf("%s: message written", tt.name)
+		}
+		if data, err := m.BytesErr(); err == nil || data != nil || m.Bytes() != nil {
+			t.Fatalf("%s: BytesErr returned %d bytes and %v", tt.name, len(data), err)
+		}
+	}
+}
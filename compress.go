@@ -0,0 +1,33 @@
+package email
+
+import (
+	"compress/flate"
+	"io"
+	"net"
+)
+
+// deflateConn is a connection compressed with DEFLATE (RFC 1951) in both
+// directions after a COMPRESS DEFLATE command. Each write is flushed, so
+// the commands and the replies are not delayed.
+type deflateConn struct {
+	net.Conn
+	r io.ReadCloser
+	w *flate.Writer
+}
+
+func newDeflateConn(conn net.Conn) *deflateConn {
+	w, _ := flate.NewWriter(conn, flate.DefaultCompression)
+	return &deflateConn{Conn: conn, r: flate.NewReader(conn), w: w}
+}
+
+func (c *deflateConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+func (c *deflateConn) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, c.w.Flush()
+}
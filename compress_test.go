@@ -0,0 +1,34 @@
+package email
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestClientCompress(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		s := newTestServer(t, "COMPRESS DEFLATE")
+
+		m := NewMessage("Hi", strings.Repeat("this is the body\r\n", 100))
+		m.From = "from@example.com"
+		m.To = []string{"to@example.com"}
+		c := NewClient(s.Addr(), nil, false)
+		c.Compress = compress
+		for i := 0; i < 2; i++ {
+			if err := c.Send(m); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := c.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		cmds := strings.Join(s.Commands(), "\n")
+		if strings.Contains(cmds, "COMPRESS DEFLATE") != compress || !strings.HasSuffix(cmds, "QUIT") {
+			t.Fatalf("unexpected commands with Compress %v: %q", compress, cmds)
+		}
+		if msgs := s.Messages(); len(msgs) != 2 || !strings.HasSuffix(msgs[1], "this is the body\n") {
+			t.Fatalf("unexpected messages: %q", msgs)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package email
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"time"
+)
+
+// TLSA is a DANE TLSA record (RFC 6698).
+type TLSA struct {
+	Usage        uint8
+	Selector     uint8
+	MatchingType uint8
+	Data         []byte
+}
+
+// LookupTLSA returns the TLSA records of name, like "_25._tcp.mx.example.com",
+// asking the first nameserver of /etc/resolv.conf. Only the records
+// validated with DNSSEC by the resolver, which sets the AD flag in its
+// response, are returned.
+func LookupTLSA(name string) ([]TLSA, error) {
+	server := "127.0.0.1:53"
+	if data, err := ioutil.ReadFile("/etc/resolv.conf"); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			f := strings.Fields(line)
+			if len(f) > 1 && f[0] == "nameserver" {
+				server = net.JoinHostPort(f[1], "53")
+				break
+			}
+		}
+	}
+
+	conn, err := net.DialTimeout("udp", server, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	var id [2]byte
+	if _, err := io.ReadFull(rand.Reader, id[:]); err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(tlsaQuery(binary.BigEndian.Uint16(id[:]), name)); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, 4096)
+	n, err := conn.Read(resp)
+	if err != nil {
+		return nil, err
+	}
+	return parseTLSAResponse(binary.BigEndian.Uint16(id[:]), resp[:n])
+}
+
+const (
+	dnsTypeTLSA = 52
+	dnsTypeOPT  = 41
+)
+
+// tlsaQuery returns a DNS query of the TLSA records of name that asks for
+// DNSSEC validation.
+func tlsaQuery(id uint16, name string) []byte {
+	var b bytes.Buffer
+	// header: recursion desired and authentic data flags, one question
+	// and one additional record
+	binary.Write(&b, binary.BigEndian, [6]uint16{id, 0x0120, 1, 0, 0, 1})
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		b.WriteByte(byte(len(label)))
+		b.WriteString(label)
+	}
+	b.WriteByte(0)
+	binary.Write(&b, binary.BigEndian, [2]uint16{dnsTypeTLSA, 1})
+	// EDNS0 OPT record with the DNSSEC OK flag
+	b.WriteByte(0)
+	binary.Write(&b, binary.BigEndian, [5]uint16{dnsTypeOPT, 4096, 0, 0x8000, 0})
+	return b.Bytes()
+}
+
+var errDNSResponse = errors.New("email: malformed DNS response")
+
+func parseTLSAResponse(id uint16, msg []byte) ([]TLSA, error) {
+	if len(msg) < 12 || binary.BigEndian.Uint16(msg) != id {
+		return nil, errDNSResponse
+	}
+	flags := binary.BigEndian.Uint16(msg[2:])
+	switch rcode := flags & 0xf; {
+	case flags&0x0200 != 0:
+		return nil, errors.New("email: truncated DNS response")
+	case rcode == 3:
+		// NXDOMAIN
+		return nil, nil
+	case rcode != 0:
+		return nil, fmt.Errorf("email: DNS lookup failed with rcode %d", rcode)
+	case flags&0x0020 == 0:
+		// not validated with DNSSEC
+		return nil, nil
+	}
+
+	qdcount := binary.BigEndian.Uint16(msg[4:])
+	ancount := binary.BigEndian.Uint16(msg[6:])
+	off := 12
+	for i := 0; i < int(qdcount); i++ {
+		if off = skipDNSName(msg, off); off < 0 || off+4 > len(msg) {
+			return nil, errDNSResponse
+		}
+		off += 4
+	}
+
+	var records []TLSA
+	for i := 0; i < int(ancount); i++ {
+		if off = skipDNSName(msg, off); off < 0 || off+10 > len(msg) {
+			return nil, errDNSResponse
+		}
+		typ := binary.BigEndian.Uint16(msg[off:])
+		rdlen := int(binary.BigEndian.Uint16(msg[off+8:]))
+		off += 10
+		if off+rdlen > len(msg) {
+			return nil, errDNSResponse
+		}
+		if typ == dnsTypeTLSA && rdlen > 3 {
+			rdata := msg[off : off+rdlen]
+			records = append(records, TLSA{
+				Usage:        rdata[0],
+				Selector:     rdata[1],
+				MatchingType: rdata[2],
+				Data:         append([]byte(nil), rdata[3:]...),
+			})
+		}
+		off += rdlen
+	}
+	return records, nil
+}
+
+// skipDNSName returns the offset after the name at off, or -1.
+func skipDNSName(msg []byte, off int) int {
+	for off < len(msg) {
+		l := int(msg[off])
+		switch {
+		case l == 0:
+			return off + 1
+		case l&0xc0 == 0xc0:
+			return off + 2
+		}
+		off += l + 1
+	}
+	return -1
+}
+
+// verifyTLSA checks that the certificates presented by the server match
+// one of the TLSA records. Except for DANE-EE records, the chain must
+// also be valid for host.
+func verifyTLSA(records []TLSA, cs tls.ConnectionState, host string) error {
+	certs := cs.PeerCertificates
+	if len(certs) == 0 {
+		return errors.New("email: no server certificate")
+	}
+
+	for _, r := range records {
+		var candidates []*x509.Certificate
+		switch r.Usage {
+		case 1, 3:
+			candidates = certs[:1]
+		case 0, 2:
+			candidates = certs[1:]
+		}
+		for _, cert := range candidates {
+			if !r.matches(cert) {
+				continue
+			}
+			if r.Usage == 3 {
+				return nil
+			}
+			opts := x509.VerifyOptions{DNSName: host, Intermediates: x509.NewCertPool()}
+			for _, c := range certs[1:] {
+				opts.Intermediates.AddCert(c)
+			}
+			if r.Usage == 2 {
+				// the matched certificate is the trust anchor
+				opts.Roots = x509.NewCertPool()
+				opts.Roots.AddCert(cert)
+			}
+			if _, err := certs[0].Verify(opts); err == nil {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("email: the certificate of %s does not match its TLSA records", host)
+}
+
+func (r TLSA) matches(cert *x509.Certificate) bool {
+	var data []byte
+	switch r.Selector {
+	case 0:
+		data = cert.Raw
+	case 1:
+		data = cert.RawSubjectPublicKeyInfo
+	default:
+		return false
+	}
+
+	switch r.MatchingType {
+	case 0:
+	case 1:
+		h := sha256.Sum256(data)
+		data = h[:]
+	case 2:
+		h := sha512.Sum512(data)
+		data = h[:]
+	default:
+		return false
+	}
+	return bytes.Equal(data, r.Data)
+}
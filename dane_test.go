@@ -0,0 +1,88 @@
+package email
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+func TestClientDANE(t *testing.T) {
+	cert := testCertificate(t, "127.0.0.1")
+	spki := sha256.Sum256(cert.Leaf.RawSubjectPublicKeyInfo)
+
+	tests := []struct {
+		records    []TLSA
+		skipverify bool
+		ok         bool
+	}{
+		// the record matches the self-signed certificate
+		{[]TLSA{{Usage: 3, Selector: 1, MatchingType: 1, Data: spki[:]}}, false, true},
+		{[]TLSA{{Usage: 3, Selector: 1, MatchingType: 1, Data: make([]byte, 32)}}, true, false},
+		// no records, the usual verification applies
+		{nil, false, false},
+		{nil, true, true},
+	}
+
+	for i, tt := range tests {
+		s := newTestServer(t, "STARTTLS")
+		s.tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+
+		var name string
+		c := NewClient(s.Addr(), nil, tt.skipverify)
+		c.DANE = true
+		c.LookupTLSA = func(n string) ([]TLSA, error) {
+			name = n
+			return tt.records, nil
+		}
+
+		err := c.connect()
+		c.Close()
+		if (err == nil) != tt.ok {
+			t.Fatalf("%d: unexpected result: %v", i, err)
+		}
+		if _, port, _ := net.SplitHostPort(s.Addr()); name != "_"+port+"._tcp.127.0.0.1" {
+			t.Fatalf("%d: unexpected TLSA name %q", i, name)
+		}
+	}
+}
+
+func TestClientDANEWithoutTLS(t *testing.T) {
+	s := newTestServer(t)
+
+	c := NewClient(s.Addr(), nil, false)
+	c.DANE = true
+	c.LookupTLSA = func(string) ([]TLSA, error) {
+		return []TLSA{{Usage: 3, Selector: 1, MatchingType: 1, Data: make([]byte, 32)}}, nil
+	}
+	if err := c.connect(); err == nil {
+		c.Close()
+		t.Fatal("expected an error for a server without STARTTLS")
+	}
+}
+
+func TestParseTLSAResponse(t *testing.T) {
+	query := tlsaQuery(0x1234, "_25._tcp.mx.example.com")
+
+	resp := append([]byte(nil), query[:len(query)-11]...)
+	binary.BigEndian.PutUint16(resp[2:], 0x81a0) // response, RD, RA, AD
+	binary.BigEndian.PutUint16(resp[6:], 1)      // one answer
+	binary.BigEndian.PutUint16(resp[10:], 0)     // no additional records
+	resp = append(resp, 0xc0, 12, 0, dnsTypeTLSA, 0, 1, 0, 0, 1, 0, 0, 7, 3, 1, 1, 0xaa, 0xbb, 0xcc, 0xdd)
+
+	records, err := parseTLSAResponse(0x1234, resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Usage != 3 || records[0].Selector != 1 ||
+		records[0].MatchingType != 1 || len(records[0].Data) != 4 {
+		t.Fatalf("unexpected records: %+v", records)
+	}
+
+	// without the AD flag the records are not trusted
+	binary.BigEndian.PutUint16(resp[2:], 0x8180)
+	if records, err := parseTLSAResponse(0x1234, resp); err != nil || records != nil {
+		t.Fatalf("unexpected records without DNSSEC: %+v, %v", records, err)
+	}
+}
@@ -0,0 +1,51 @@
+package email
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"regexp"
+	"strings"
+)
+
+// DedupInline removes the inline attachments referenced by the HTML body
+// with a cid: URL that have the same content as another one, and points
+// their cid: URLs in the body to the attachment that is kept, so the
+// content is only written once. It returns the number of attachments
+// removed. Attachments with a Source or a Content-Location and bodies
+// read from BodyReader are left as they are.
+func (m *Message) DedupInline() int {
+	if m.BodyReader != nil {
+		return 0
+	}
+
+	var names []string
+	for _, name := range m.attachmentNames() {
+		a := m.Attachments[name]
+		if m.related(a) && a.ContentID != "" && a.ContentLocation == "" && a.Source == nil {
+			names = append(names, name)
+		}
+	}
+
+	kept := make(map[[sha256.Size]byte]*Attachment)
+	removed := 0
+	for _, name := range names {
+		a := m.Attachments[name]
+		sum := sha256.Sum256(a.Data)
+		k, ok := kept[sum]
+		if !ok || k.ContentType != a.ContentType || !bytes.Equal(k.Data, a.Data) {
+			kept[sum] = a
+			continue
+		}
+		m.Body = replaceCID(m.Body, strings.Trim(a.ContentID, "<>"), strings.Trim(k.ContentID, "<>"))
+		delete(m.Attachments, name)
+		removed++
+	}
+	return removed
+}
+
+// replaceCID replaces the whole cid: URLs of id in the HTML body with
+// cid: URLs of newID, so the URLs of other ids starting with id are kept.
+func replaceCID(body, id, newID string) string {
+	re := regexp.MustCompile(`(?i:cid:)` + regexp.QuoteMeta(id) + `(["'()<>\s]|$)`)
+	return re.ReplaceAllString(body, "cid:"+strings.Replace(newID, "$", "$$", -1)+"${1}")
+}
@@ -0,0 +1,49 @@
+package email
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDedupInline(t *testing.T) {
+	m := NewHTMLMessage("Hi", `<img src="cid:logo1"><img src="cid:logo2"><img src="cid:icon">`)
+	logo := []byte("\x89PNG logo")
+	m.Attachments["a.png"] = &Attachment{Filename: "a.png", Data: logo, Inline: true, ContentType: "image/png", ContentID: "logo1"}
+	m.Attachments["b.png"] = &Attachment{Filename: "b.png", Data: logo, Inline: true, ContentType: "image/png", ContentID: "logo2"}
+	m.Attachments["c.png"] = &Attachment{Filename: "c.png", Data: []byte("\x89PNG icon"), Inline: true, ContentType: "image/png", ContentID: "icon"}
+
+	if n := m.DedupInline(); n != 1 {
+		t.Fatalf("removed %d attachments", n)
+	}
+	if m.Body != `<img src="cid:logo1"><img src="cid:logo1"><img src="cid:icon">` {
+		t.Fatalf("unexpected body %q", m.Body)
+	}
+
+	data := string(m.Bytes())
+	if n := strings.Count(data, "Content-Type: image/png"); n != 2 {
+		t.Fatalf("expected 2 image parts, got %d:\n%s", n, data)
+	}
+	if strings.Contains(data, "b.png") {
+		t.Fatalf("duplicate attachment written:\n%s", data)
+	}
+	if err := m.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+
+	m = NewHTMLMessage("Hi", `<img src="cid:icon-big"><img src="cid:icon"><img src='cid:icon2'>`+
+		`<div style="background: url(cid:icon)"></div><img src=cid:icon>`)
+	icon := []byte("\x89PNG icon")
+	m.Attachments["big.png"] = &Attachment{Filename: "big.png", Data: icon, Inline: true, ContentType: "image/png", ContentID: "icon-big"}
+	m.Attachments["icon.png"] = &Attachment{Filename: "icon.png", Data: icon, Inline: true, ContentType: "image/png", ContentID: "icon"}
+	m.Attachments["icon2.png"] = &Attachment{Filename: "icon2.png", Data: []byte("\x89PNG icon2"), Inline: true, ContentType: "image/png", ContentID: "icon2"}
+	m.SortAttachments(func(a, b *Attachment) bool { return a.Filename < b.Filename })
+
+	if n := m.DedupInline(); n != 1 {
+		t.Fatalf("removed %d attachments", n)
+	}
+	want := `<img src="cid:icon-big"><img src="cid:icon-big"><img src='cid:icon2'>` +
+		`<div style="background: url(cid:icon-big)"></div><img src=cid:icon-big>`
+	if m.Body != want {
+		t.Fatalf("unexpected body %q", m.Body)
+	}
+}
@@ -0,0 +1,120 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+// defaultFallbackDelay is the default of Client.FallbackDelay, as
+// recommended by RFC 8305.
+const defaultFallbackDelay = 300 * time.Millisecond
+
+// lookupIPAddr resolves the host of the server. It is a variable so tests
+// can replace it.
+var lookupIPAddr = net.DefaultResolver.LookupIPAddr
+
+// dial connects to c.Addr. When the host has both IPv6 and IPv4 addresses
+// they are tried concurrently (Happy Eyeballs, RFC 8305): the family of
+// the first address is tried first and the other one after
+// FallbackDelay or as soon as the first fails, and the first connection
+// established is used, so a broken path to one of the families does not
+// stall until the timeout.
+func (c *Client) dial(timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	host, port, err := net.SplitHostPort(c.Addr)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := lookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	var primaries, fallbacks []net.IPAddr
+	for _, a := range addrs {
+		if local, ok := c.LocalAddr.(*net.TCPAddr); ok && (local.IP.To4() == nil) != (a.IP.To4() == nil) {
+			continue
+		}
+		if len(primaries) == 0 || (a.IP.To4() == nil) == (primaries[0].IP.To4() == nil) {
+			primaries = append(primaries, a)
+		} else {
+			fallbacks = append(fallbacks, a)
+		}
+	}
+	if len(primaries) == 0 {
+		return nil, errors.New("email: no suitable address for " + host)
+	}
+
+	type result struct {
+		conn    net.Conn
+		err     error
+		primary bool
+	}
+	results := make(chan result)
+	dialer := &net.Dialer{LocalAddr: c.LocalAddr}
+	race := func(ctx context.Context, addrs []net.IPAddr, primary bool) {
+		var err error
+		for _, a := range addrs {
+			var conn net.Conn
+			if conn, err = dialer.DialContext(ctx, "tcp", net.JoinHostPort(a.String(), port)); err == nil {
+				select {
+				case results <- result{conn: conn, primary: primary}:
+				case <-ctx.Done():
+					conn.Close()
+				}
+				return
+			}
+		}
+		select {
+		case results <- result{err: err, primary: primary}:
+		case <-ctx.Done():
+		}
+	}
+
+	raceCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	go race(raceCtx, primaries, true)
+
+	delay := c.FallbackDelay
+	if delay == 0 {
+		delay = defaultFallbackDelay
+	}
+	fallback := time.NewTimer(delay)
+	defer fallback.Stop()
+
+	var firstErr error
+	pending := 1
+	startFallback := func() {
+		if fallbacks != nil {
+			go race(raceCtx, fallbacks, false)
+			fallbacks = nil
+			pending++
+		}
+	}
+	for {
+		select {
+		case <-fallback.C:
+			startFallback()
+		case <-ctx.Done():
+			if firstErr == nil {
+				firstErr = ctx.Err()
+			}
+			return nil, firstErr
+		case r := <-results:
+			if r.err == nil {
+				return r.conn, nil
+			}
+			if firstErr == nil || r.primary {
+				firstErr = r.err
+			}
+			pending--
+			startFallback()
+			if pending == 0 {
+				return nil, firstErr
+			}
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package email
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestClientDialFallback(t *testing.T) {
+	s := newTestServer(t)
+	_, port, _ := net.SplitHostPort(s.Addr())
+	defer func(f func(context.Context, string) ([]net.IPAddr, error)) { lookupIPAddr = f }(lookupIPAddr)
+
+	for _, addrs := range [][]string{
+		// an unreachable IPv6 address, tried first
+		{"100::1", "127.0.0.1"},
+		// a closed port
+		{"::1", "127.0.0.1"},
+	} {
+		lookupIPAddr = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+			var ips []net.IPAddr
+			for _, a := range addrs {
+				ips = append(ips, net.IPAddr{IP: net.ParseIP(a)})
+			}
+			return ips, nil
+		}
+
+		c := NewClient(net.JoinHostPort("relay.example.com", port), nil, false)
+		c.FallbackDelay = 50 * time.Millisecond
+		c.Timeouts.Dial = 5 * time.Second
+		start := time.Now()
+		conn, err := c.dial(c.timeouts().Dial)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+		if d := time.Since(start); d > time.Second {
+			t.Fatalf("connected to %s after %v", addrs, d)
+		}
+	}
+
+	lookupIPAddr = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		return []net.IPAddr{{IP: net.ParseIP("100::1")}}, nil
+	}
+	c := NewClient(net.JoinHostPort("relay.example.com", port), nil, false)
+	if _, err := c.dial(200 * time.Millisecond); err == nil {
+		t.Fatal("expected an error")
+	}
+}
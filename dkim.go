@@ -0,0 +1,85 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+)
+
+// DKIMBodyHash returns the base64 SHA-256 hash of the canonicalized body of
+// the message, the bh= tag of a DKIM signature (RFC 6376), for signers
+// that keep the private key out of this package. The canonicalization is
+// relaxed or simple. The multipart boundaries used and the Date are kept
+// for the following writes, so the message must not be modified afterwards
+// except to set DKIMSignature, and the headers to sign are the ones of
+// HeaderList. DKIMBodyHash fails with a BodyReader, which can only be read
+// once.
+func (m *Message) DKIMBodyHash(relaxed bool) (string, error) {
+	if m.BodyReader != nil {
+		return "", errors.New("email: can not hash a BodyReader")
+	}
+
+	b := m.newBoundaries()
+	var body bytes.Buffer
+	buf := bufio.NewWriter(&body)
+	if err := m.writePart(buf, m.innerPart(-1), b, nil); err != nil {
+		return "", err
+	}
+	buf.Flush()
+	m.fixed = &b
+	m.date = nowFunc()
+
+	// the body is hashed as sent, with the bare LFs as CRLF
+	h := sha256.Sum256(canonicalBody(toCRLF(body.Bytes()), relaxed))
+	return base64.StdEncoding.EncodeToString(h[:]), nil
+}
+
+// canonicalBody returns body with the simple or relaxed canonicalization
+// of RFC 6376, section 3.4.
+func canonicalBody(body []byte, relaxed bool) []byte {
+	lines := bytes.Split(body, []byte("\r\n"))
+	if relaxed {
+		for i, l := range lines {
+			var out []byte
+			space := false
+			for _, c := range l {
+				if c == ' ' || c == '\t' {
+					space = true
+					continue
+				}
+				if space {
+					out = append(out, ' ')
+					space = false
+				}
+				out = append(out, c)
+			}
+			lines[i] = out
+		}
+	}
+
+	for len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		if relaxed {
+			return nil
+		}
+		return []byte("\r\n")
+	}
+	return append(bytes.Join(lines, []byte("\r\n")), "\r\n"...)
+}
+
+// toCRLF returns data with its bare LFs converted to CRLF, like
+// textproto.DotWriter does when sending it.
+func toCRLF(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	for i, c := range data {
+		if c == '\n' && (i == 0 || data[i-1] != '\r') {
+			out = append(out, '\r')
+		}
+		out = append(out, c)
+	}
+	return out
+}
@@ -0,0 +1,127 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCanonicalBody(t *testing.T) {
+	tests := []struct {
+		body    string
+		relaxed bool
+		want    string
+	}{
+		{"", false, "\r\n"},
+		{"", true, ""},
+		{" C \r\nD \t E\r\n\r\n\r\n", false, " C \r\nD \t E\r\n"},
+		{" C \r\nD \t E\r\n\r\n\r\n", true, " C\r\nD E\r\n"},
+		{"no newline", false, "no newline\r\n"},
+	}
+	for _, tt := range tests {
+		if got := string(canonicalBody([]byte(tt.body), tt.relaxed)); got != tt.want {
+			t.Errorf("canonicalBody(%q, %v) = %q, want %q", tt.body, tt.relaxed, got, tt.want)
+		}
+	}
+}
+
+func TestDKIMBodyHash(t *testing.T) {
+	m := NewHTMLMessage("Hi", "<p>Hello   world</p>  ")
+	m.AutoPlainText = true
+	m.Attachments["a.txt"] = &Attachment{Filename: "a.txt", Data: []byte("attachment")}
+
+	bh, err := m.DKIMBodyHash(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.DKIMSignature = "v=1; a=rsa-sha256; d=example.com; s=sel; h=from:to:subject; bh=" + bh + "; b=abc"
+
+	for i := 0; i < 2; i++ {
+		data := m.Bytes()
+		if !bytes.HasPrefix(data, []byte("DKIM-Signature: "+m.DKIMSignature+"\r\n")) {
+			t.Fatalf("missing DKIM-Signature at the top:\n%s", data)
+		}
+		body := data[bytes.Index(data, []byte("\r\n\r\n"))+4:]
+		h := sha256.Sum256(canonicalBody(body, true))
+		if got := base64.StdEncoding.EncodeToString(h[:]); got != bh {
+			t.Fatalf("body hash %s of the written message, want %s", got, bh)
+		}
+	}
+
+	// a trailing line break of the body does not change the hash
+	a, b := NewMessage("Hi", "body"), NewMessage("Hi", "body\r\n")
+	ha, _ := a.DKIMBodyHash(false)
+	hb, _ := b.DKIMBodyHash(false)
+	if ha != hb {
+		t.Fatalf("different body hashes %s and %s", ha, hb)
+	}
+
+	m = NewMessage("Hi", "")
+	m.BodyReader = strings.NewReader("body")
+	if _, err := m.DKIMBodyHash(false); err == nil {
+		t.Fatal("expected an error with a BodyReader")
+	}
+}
+
+func TestDKIMBodyHashLF(t *testing.T) {
+	for _, relaxed := range []bool{false, true} {
+		m := NewMessage("Hi", "line1\nline2\n")
+		m.Attachments["a.txt"] = &Attachment{Filename: "a.txt", Data: []byte("attachment")}
+		bh, err := m.DKIMBodyHash(relaxed)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the data as sent after the DATA command
+		var wire bytes.Buffer
+		w := textproto.NewWriter(bufio.NewWriter(&wire)).DotWriter()
+		m.WriteTo(w)
+		w.Close()
+		data := strings.TrimSuffix(wire.String(), ".\r\n")
+		body := data[strings.Index(data, "\r\n\r\n")+4:]
+		if strings.Contains(strings.Replace(body, "\r\n", "", -1), "\n") {
+			t.Fatalf("bare LF on the wire: %q", body)
+		}
+		h := sha256.Sum256(canonicalBody([]byte(body), relaxed))
+		if got := base64.StdEncoding.EncodeToString(h[:]); got != bh {
+			t.Fatalf("body hash %s of the sent message, want %s (relaxed %v)", got, bh, relaxed)
+		}
+	}
+}
+
+func TestHeaderList(t *testing.T) {
+	m := NewHTMLMessage("Hi", "<p>Hello</p>")
+	m.From = "from@example.com"
+	m.To = []string{"to@example.com"}
+	m.MessageID = "1@example.com"
+	m.Attachments["a.txt"] = &Attachment{Filename: "a.txt", Data: []byte("attachment")}
+	if _, err := m.DKIMBodyHash(true); err != nil {
+		t.Fatal(err)
+	}
+
+	headers := m.HeaderList()
+	names := make([]string, len(headers))
+	for i, h := range headers {
+		names[i] = strings.ToLower(h.Name)
+	}
+	m.DKIMSignature = "v=1; a=rsa-sha256; d=example.com; s=sel; h=" + strings.Join(names, ":") + "; bh=abc; b=abc"
+
+	time.Sleep(time.Second)
+	data := string(m.Bytes())
+	block := data[:strings.Index(data, "\r\n\r\n")+2]
+	lines := strings.SplitAfter(block, "\r\n")
+	lines = lines[1 : len(lines)-1]
+	if len(lines) != len(headers) {
+		t.Fatalf("%d headers signed, %d written:\n%s", len(headers), len(lines), block)
+	}
+	for i, h := range headers {
+		if lines[i] != h.Name+": "+h.Value+"\r\n" {
+			t.Fatalf("signed header %q, written %q", h.Name+": "+h.Value, lines[i])
+		}
+	}
+}
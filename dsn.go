@@ -0,0 +1,172 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// SetOriginalRecipient sets the address that rcpt had when the message
+// was first submitted, before an alias or a forwarder rewrote it. It is
+// sent as the ORCPT parameter of the recipient (RFC 3461) when the server
+// supports delivery status notifications, so they refer to orig. orig must
+// be an ASCII address.
+func (m *Message) SetOriginalRecipient(rcpt, orig string) error {
+	if orig == "" {
+		return fmt.Errorf("email: empty original recipient of %s", rcpt)
+	}
+	for _, c := range orig {
+		if c < 33 || c > 126 {
+			return fmt.Errorf("email: invalid original recipient %q", orig)
+		}
+	}
+
+	if m.OriginalRecipients == nil {
+		m.OriginalRecipients = make(map[string]string)
+	}
+	m.OriginalRecipients[rcpt] = orig
+	return nil
+}
+
+// xtext returns s encoded as xtext (RFC 3461), where "+", "=" and the
+// characters out of "!" to "~" are written as "+" and their hex code.
+func xtext(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < '!' || c > '~' || c == '+' || c == '=' {
+			fmt.Fprintf(&b, "+%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// DeliveryStatus is the report of a delivery status notification (RFC
+// 3464).
+type DeliveryStatus struct {
+	// ReportingMTA is the host name of the server reporting the status.
+	ReportingMTA string
+	// ArrivalDate, if not zero, is when the message arrived.
+	ArrivalDate time.Time
+	Recipients  []RecipientStatus
+	// Headers, if set, are the headers of the original message returned
+	// with the report.
+	Headers []byte
+}
+
+// RecipientStatus is the delivery status of a recipient.
+type RecipientStatus struct {
+	// FinalRecipient is the address of the recipient.
+	FinalRecipient string
+	// OriginalRecipient, if set, is the address from the ORCPT
+	// parameter.
+	OriginalRecipient string
+	// Action is "failed", "delayed", "delivered", "relayed" or
+	// "expanded".
+	Action string
+	// Status is the enhanced status code, like "5.1.1".
+	Status string
+	// RemoteMTA, if set, is the host name of the server that reported
+	// the status.
+	RemoteMTA string
+	// DiagnosticCode, if set, is the SMTP reply of RemoteMTA, like
+	// "550 5.1.1 User unknown".
+	DiagnosticCode string
+}
+
+var statusRe = regexp.MustCompile(`^[245]\.[0-9]{1,3}\.[0-9]{1,3}$`)
+
+// NewDSNReport returns a delivery status notification, like a bounce, with
+// a multipart/report body (RFC 3464): the human readable body, the
+// machine readable status and the returned headers. It is meant for
+// servers that report the delivery of the messages they relay. The report
+// has NullSender set, so it is sent with an empty envelope sender.
+func NewDSNReport(subject, body string, status *DeliveryStatus) (*Message, error) {
+	if status.ReportingMTA == "" || strings.ContainsAny(status.ReportingMTA, " \t\r\n") {
+		return nil, fmt.Errorf("email: invalid reporting MTA %q", status.ReportingMTA)
+	}
+	if len(status.Recipients) == 0 {
+		return nil, errors.New("email: a delivery status needs a recipient")
+	}
+	for _, r := range status.Recipients {
+		switch r.Action {
+		case "failed", "delayed", "delivered", "relayed", "expanded":
+		default:
+			return nil, fmt.Errorf("email: invalid action %q of %s", r.Action, r.FinalRecipient)
+		}
+		if !statusRe.MatchString(r.Status) {
+			return nil, fmt.Errorf("email: invalid status %q of %s", r.Status, r.FinalRecipient)
+		}
+		for _, f := range []string{r.FinalRecipient, r.OriginalRecipient, r.RemoteMTA, r.DiagnosticCode} {
+			if strings.ContainsAny(f, "\r\n") {
+				return nil, fmt.Errorf("email: invalid status field %q", f)
+			}
+		}
+	}
+
+	m := NewMessage(subject, body)
+	m.DeliveryStatus = status
+	m.NullSender = true
+	return m, nil
+}
+
+// write writes the delivery status and the returned headers as parts of
+// the multipart/report with boundary.
+func (s *DeliveryStatus) write(buf *bufio.Writer, boundary string) {
+	var w strings.Builder
+	w.WriteString("Reporting-MTA: dns; " + s.ReportingMTA + "\r\n")
+	if !s.ArrivalDate.IsZero() {
+		w.WriteString("Arrival-Date: " + s.ArrivalDate.Format(time.RFC1123Z) + "\r\n")
+	}
+	for _, r := range s.Recipients {
+		w.WriteString("\r\n")
+		if r.OriginalRecipient != "" {
+			w.WriteString("Original-Recipient: rfc822; " + r.OriginalRecipient + "\r\n")
+		}
+		w.WriteString("Final-Recipient: rfc822; " + r.FinalRecipient + "\r\n")
+		w.WriteString("Action: " + r.Action + "\r\n")
+		w.WriteString("Status: " + r.Status + "\r\n")
+		if r.RemoteMTA != "" {
+			w.WriteString("Remote-MTA: dns; " + r.RemoteMTA + "\r\n")
+		}
+		if r.DiagnosticCode != "" {
+			w.WriteString("Diagnostic-Code: smtp; " + r.DiagnosticCode + "\r\n")
+		}
+	}
+	w.WriteString("\r\n")
+
+	buf.WriteString("--" + boundary + "\r\n")
+	writePartHeaders(buf, map[string]string{
+		"Content-Type":              "message/delivery-status",
+		"Content-Transfer-Encoding": rawEncoding(w.String()),
+	})
+	buf.WriteString(w.String())
+
+	if len(s.Headers) > 0 {
+		buf.WriteString("--" + boundary + "\r\n")
+		headers := bytes.TrimRight(s.Headers, "\r\n")
+		writePartHeaders(buf, map[string]string{
+			"Content-Type":              "text/rfc822-headers",
+			"Content-Transfer-Encoding": rawEncoding(string(headers)),
+		})
+		buf.Write(headers)
+		buf.WriteString("\r\n")
+	}
+}
+
+// rawEncoding returns the Content-Transfer-Encoding of text written as is:
+// 7bit for ASCII, otherwise 8bit.
+func rawEncoding(s string) string {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return "8bit"
+		}
+	}
+	return "7bit"
+}
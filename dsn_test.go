@@ -0,0 +1,173 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+func TestXtext(t *testing.T) {
+	for s, want := range map[string]string{
+		"user@example.com":       "user@example.com",
+		"user+tag@example.com":   "user+2Btag@example.com",
+		"a=b@example.com":        "a+3Db@example.com",
+		"\"a b\"@example.com":    "\"a+20b\"@example.com",
+		"ünicode@example.com":    "+C3+BCnicode@example.com",
+		"!#$%&'*/?^_`{|}~@x.com": "!#$%&'*/?^_`{|}~@x.com",
+	} {
+		if got := xtext(s); got != want {
+			t.Errorf("xtext(%q) = %q, want %q", s, got, want)
+		}
+	}
+}
+
+func TestOriginalRecipient(t *testing.T) {
+	for _, dsn := range []bool{true, false} {
+		var s *testServer
+		if dsn {
+			s = newTestServer(t, "DSN")
+		} else {
+			s = newTestServer(t)
+		}
+
+		m := NewMessage("Hi", "this is the body")
+		m.From = "from@example.com"
+		m.To = []string{"alice@example.net", "bob@example.net"}
+		if err := m.SetOriginalRecipient("alice@example.net", "list+alice@example.com"); err != nil {
+			t.Fatal(err)
+		}
+		if err := Send(s.Addr(), nil, m, false); err != nil {
+			t.Fatal(err)
+		}
+
+		cmds := strings.Join(s.Commands(), "\n")
+		want := "RCPT TO:<alice@example.net>\nRCPT TO:<bob@example.net>\n"
+		if dsn {
+			want = "RCPT TO:<alice@example.net> ORCPT=rfc822;list+2Balice@example.com\nRCPT TO:<bob@example.net>\n"
+		}
+		if !strings.Contains(cmds, want) {
+			t.Fatalf("unexpected commands with DSN %v:\n%s", dsn, cmds)
+		}
+	}
+
+	m := NewMessage("Hi", "this is the body")
+	for _, orig := range []string{"", "a b@example.com", "ünicode@example.com", "a@example.com\r\n"} {
+		if err := m.SetOriginalRecipient("a@example.com", orig); err == nil {
+			t.Fatalf("expected an error for %q", orig)
+		}
+	}
+}
+
+func TestNewDSNReport(t *testing.T) {
+	status := &DeliveryStatus{
+		ReportingMTA: "mx.example.com",
+		Recipients: []RecipientStatus{{
+			FinalRecipient:    "bob@example.net",
+			OriginalRecipient: "list+bob@example.com",
+			Action:            "failed",
+			Status:            "5.1.1",
+			RemoteMTA:         "mx.example.net",
+			DiagnosticCode:    "550 5.1.1 User unknown",
+		}},
+		Headers: []byte("From: alice@example.com\r\nTo: bob@example.net\r\nSubject: Hello\r\n"),
+	}
+	m, err := NewDSNReport("Undelivered Mail Returned to Sender", "Your message could not be delivered.", status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.From = "MAILER-DAEMON@mx.example.com"
+	m.To = []string{"alice@example.com"}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(m.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/report" || params["report-type"] != "delivery-status" {
+		t.Fatalf("unexpected Content-Type %q", msg.Header.Get("Content-Type"))
+	}
+
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	var parts []string
+	var contents [][]byte
+	for {
+		p, err := mr.NextPart()
+		if err != nil {
+			break
+		}
+		if cte := p.Header.Get("Content-Transfer-Encoding"); cte != "7bit" {
+			t.Fatalf("unexpected Content-Transfer-Encoding %q of %s", cte, p.Header.Get("Content-Type"))
+		}
+		data, _ := ioutil.ReadAll(p)
+		parts = append(parts, strings.SplitN(p.Header.Get("Content-Type"), ";", 2)[0])
+		contents = append(contents, data)
+	}
+	if strings.Join(parts, ",") != "text/plain,message/delivery-status,text/rfc822-headers" {
+		t.Fatalf("unexpected parts %v", parts)
+	}
+
+	// the line break that ends the last group is part of the boundary
+	tp := textproto.NewReader(bufio.NewReader(bytes.NewReader(append(contents[1], "\r\n"...))))
+	perMessage, err := tp.ReadMIMEHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	perRecipient, err := tp.ReadMIMEHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perMessage.Get("Reporting-MTA") != "dns; mx.example.com" ||
+		perRecipient.Get("Final-Recipient") != "rfc822; bob@example.net" ||
+		perRecipient.Get("Original-Recipient") != "rfc822; list+bob@example.com" ||
+		perRecipient.Get("Action") != "failed" || perRecipient.Get("Status") != "5.1.1" ||
+		perRecipient.Get("Diagnostic-Code") != "smtp; 550 5.1.1 User unknown" {
+		t.Fatalf("unexpected delivery status:\n%s", contents[1])
+	}
+	if string(contents[2]) != "From: alice@example.com\r\nTo: bob@example.net\r\nSubject: Hello" {
+		t.Fatalf("unexpected returned headers %q", contents[2])
+	}
+
+	for _, r := range []RecipientStatus{
+		{FinalRecipient: "bob@example.net", Action: "bounced", Status: "5.1.1"},
+		{FinalRecipient: "bob@example.net", Action: "failed", Status: "550"},
+		{FinalRecipient: "bob@example.net\r\nX: y", Action: "failed", Status: "5.1.1"},
+	} {
+		status.Recipients = []RecipientStatus{r}
+		if _, err := NewDSNReport("", "", status); err == nil {
+			t.Fatalf("expected an error for %+v", r)
+		}
+	}
+}
+
+func TestDSNReportNullSender(t *testing.T) {
+	status := &DeliveryStatus{
+		ReportingMTA: "mx.example.com",
+		Recipients:   []RecipientStatus{{FinalRecipient: "bob@example.net", Action: "failed", Status: "5.1.1"}},
+	}
+	m, err := NewDSNReport("Undelivered Mail Returned to Sender", "Your message could not be delivered.", status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.From = "MAILER-DAEMON@mx.example.com"
+	m.To = []string{"alice@example.com"}
+	m.EnvelopeFrom = "bounces@mx.example.com"
+
+	s := newTestServer(t)
+	c := NewClient(s.Addr(), nil, false)
+	defer c.Close()
+	if err := c.Send(m); err != nil {
+		t.Fatal(err)
+	}
+	if cmds := strings.Join(s.Commands(), "\n"); !strings.Contains(cmds, "\nMAIL FROM:<>\n") {
+		t.Fatalf("report not sent with a null sender:\n%s", cmds)
+	}
+	if msg := s.Messages()[0]; !strings.Contains(msg, "From: MAILER-DAEMON@mx.example.com\n") {
+		t.Fatalf("unexpected report:\n%s", msg)
+	}
+}
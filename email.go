@@ -3,23 +3,87 @@
 package email
 
 import (
+	"bufio"
 	"bytes"
-	"crypto/tls"
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
 	"io/ioutil"
-	"net"
+	"mime"
+	"net/mail"
 	"net/smtp"
+	"net/textproto"
+	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf16"
 )
 
 type Attachment struct {
 	Filename string
 	Data     []byte
 	Inline   bool
+	// ContentType defaults to application/octet-stream.
+	ContentType string
+	// ContentID, if set, is written as the Content-ID of the part so
+	// other parts can reference it.
+	ContentID string
+	// ContentLocation, if set, is written as the Content-Location of the
+	// part (RFC 2557), so an HTML body can reference an inline part by
+	// URL instead of with a cid: URL.
+	ContentLocation string
+	// Description, if set, is written as the Content-Description of the
+	// part, encoded if it is not ASCII.
+	Description string
+	// CreationDate and ModificationDate, if not zero, are written in the
+	// Content-Disposition of the part (RFC 2183).
+	CreationDate     time.Time
+	ModificationDate time.Time
+	// Source, if set, is used instead of Data. It is opened each time the
+	// message is written and streamed, so large files are not kept in
+	// memory.
+	Source AttachmentSource
+}
+
+// AttachmentSource provides the content of an attachment.
+type AttachmentSource interface {
+	Open() (io.ReadCloser, error)
+}
+
+// FileSource returns an AttachmentSource that reads the named file.
+func FileSource(name string) AttachmentSource {
+	return fileSource(name)
+}
+
+type fileSource string
+
+func (f fileSource) Open() (io.ReadCloser, error) {
+	return os.Open(string(f))
+}
+
+func (f fileSource) Size() (int64, error) {
+	fi, err := os.Stat(string(f))
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+// Header is a header field of a message.
+type Header struct {
+	Name  string
+	Value string
 }
 
 type Message struct {
@@ -28,10 +92,147 @@ type Message struct {
 	Cc              []string
 	Bcc             []string
 	ReplyTo         string
+	Sender          string
 	Subject         string
 	Body            string
 	BodyContentType string
-	Attachments     map[string]*Attachment
+	// Charset of the text of the message, utf-8 by default. Body, the
+	// encoded headers and the filenames of the attachments are written in
+	// it, with "?" for the characters it can not represent; BodyReader must
+	// already be in it. utf-8, iso-8859-1 and us-ascii are supported.
+	Charset string
+	// EnvelopeFrom, if set, is the address sent in the MAIL FROM command,
+	// which receives the bounces, instead of From. Gmail shows the
+	// message "via" its domain if it is not aligned with the domain of
+	// From, see AlignEnvelope.
+	EnvelopeFrom string
+	// NullSender sends the message with an empty envelope sender, the
+	// null reverse-path "MAIL FROM:<>" of the delivery status
+	// notifications, so they never cause a bounce themselves. It takes
+	// precedence over EnvelopeFrom and Client.SenderFromAuth.
+	NullSender bool
+	// BodyEncoding is the Content-Transfer-Encoding of the text parts:
+	// "7bit", "8bit", "quoted-printable" or "base64". By default it is
+	// 7bit for ASCII text and 8bit otherwise, and Client switches to
+	// quoted-printable if the server does not support 8BITMIME.
+	BodyEncoding string
+	// BodyFilename, if set, is written as the filename of the inline
+	// Content-Disposition of the body part, so clients can save it with
+	// that name.
+	BodyFilename string
+	// Strict makes WriteTo fail instead of writing a message that breaks
+	// the rules of RFC 5322 and RFC 2045 checked by checkStrict: line
+	// endings and lengths, the required headers, ASCII headers and the
+	// content allowed by the Content-Transfer-Encoding of each part.
+	Strict bool
+	// StrictContentType makes Validate fail if a text/plain body looks
+	// like HTML, which is usually a message created with NewMessage
+	// instead of NewHTMLMessage.
+	StrictContentType bool
+	// OmitCharset removes the charset parameter of text bodies. The other
+	// types never have it unless it is included in BodyContentType.
+	OmitCharset bool
+	// BodyReader, if set, is streamed as the body instead of Body.
+	// It is consumed by the first call to WriteTo.
+	BodyReader io.Reader
+	// AutoPlainText adds a plain text alternative derived from the body
+	// of an HTML message.
+	AutoPlainText bool
+	// AttachmentHashHeader adds an X-Attachment-SHA256 header with the
+	// hex SHA-256 of the content to the attachments kept in Data. The ones
+	// with a Source are streamed, so their hash is only known after they
+	// are written: use WriteToWithHashes to get it.
+	AttachmentHashHeader bool
+	// Attachments are written in the order they are added by the methods
+	// of Message, followed by the ones set directly sorted by key. See
+	// SortAttachments.
+	Attachments map[string]*Attachment
+	// Translations are the versions of the message in other languages
+	// added with AddTranslation.
+	Translations []Translation
+	// DeliveryStatus, if set, makes the message a delivery status
+	// notification, see NewDSNReport.
+	DeliveryStatus *DeliveryStatus
+	// Trace headers are written in order at the top of the header block.
+	Trace []Header
+	// ExtraHeaders are written after the other headers, for the headers
+	// not supported by this package like X-Entity-Ref-ID. The values must
+	// be encoded and folded, see SetJSONHeader.
+	ExtraHeaders []Header
+	// Precedence, like "bulk" or "list", keeps auto-responders quiet.
+	Precedence string
+	// ReadReceiptTo, if set, is the address written in the
+	// Disposition-Notification-To header to request a read receipt
+	// (RFC 8098). ReadReceiptOptions are written with it in the
+	// Disposition-Notification-Options header.
+	ReadReceiptTo      string
+	ReadReceiptOptions []MDNOption
+	// ReportAbuse, if set, is written in the X-Report-Abuse header, the
+	// URL or mailbox where bulk messages are reported, like
+	// "Please report abuse here: https://example.com/abuse".
+	ReportAbuse string
+	// Sensitivity, if set, is written in the Sensitivity header shown by
+	// Outlook: "Personal", "Private" or "Company-Confidential".
+	Sensitivity string
+	// Comments, if set, is written in the Comments header, encoded if it
+	// is not ASCII.
+	Comments string
+	// Keywords are written in the Keywords header, separated by commas
+	// and encoded if they are not ASCII.
+	Keywords []string
+	// AutoResponseSuppress are the auto-replies suppressed by Exchange,
+	// like "OOF", "AutoReply", "DR", "RN", "NRN" or "All".
+	AutoResponseSuppress []string
+	// MessageID, InReplyTo and References are the threading headers.
+	// The ids are written between angle brackets.
+	MessageID  string
+	InReplyTo  string
+	References []string
+	// OriginalMessageID is the id of a message this one is a resend of,
+	// like a reminder. It is written in X-Original-Message-ID and at the
+	// start of References, so the message is threaded with the original.
+	OriginalMessageID string
+	// Location is the time zone of the Date header. Defaults to local time.
+	Location *time.Location
+	// RequireTLS asks the server to only relay the message over TLS
+	// (RFC 8689). Client then fails if the connection is not encrypted or
+	// the server does not support REQUIRETLS. TLSOptional, instead, adds
+	// the "TLS-Required: No" header asking to deliver it even if the TLS
+	// policies of the recipient domains can not be met.
+	RequireTLS  bool
+	TLSOptional bool
+	// Expires, if not zero, is written in the Expires and Expiry-Date
+	// headers (RFC 4021), so clients can flag the message once expired.
+	Expires time.Time
+	// ListHeaders are the mailing list headers set with SetListHeader.
+	ListHeaders map[string]string
+	// ValidSince maps recipient addresses to the dates set with
+	// SetRecipientValidSince.
+	ValidSince map[string]string
+	// OriginalRecipients maps recipient addresses to the addresses set
+	// with SetOriginalRecipient.
+	OriginalRecipients map[string]string
+	// IdempotencyKey identifies the message for Client.Idempotency. It is
+	// not written in the message.
+	IdempotencyKey string
+	// DKIMSignature, if set, is the value of a DKIM-Signature header
+	// computed by an external signer, written at the top of the message.
+	// See DKIMBodyHash. Client fails to send a signed message instead of
+	// rewriting it for a server without 8BITMIME or SMTPUTF8, or to add
+	// the Sender of SenderFromAuth.
+	DKIMSignature string
+	// UnixLineEndings makes Bytes and SaveEML use LF line endings, as
+	// some tools expect. WriteTo and the messages sent always use CRLF.
+	UnixLineEndings bool
+
+	// order are the keys of the attachments in the order they were added.
+	order []string
+
+	// fixed and date are the boundaries and the Date fixed by
+	// DKIMBodyHash, reused by the following writes so the signed content
+	// does not change.
+	fixed *boundaries
+	date  time.Time
 }
 
 func (m *Message) attach(file string, inline bool) error {
@@ -42,15 +243,131 @@ func (m *Message) attach(file string, inline bool) error {
 
 	_, filename := filepath.Split(file)
 
-	m.Attachments[filename] = &Attachment{
-		Filename: filename,
-		Data:     data,
-		Inline:   inline,
+	m.addAttachment(filename, data, inline)
+
+	return nil
+}
+
+// AttachFS attaches the named file of fsys, like the files embedded with
+// a //go:embed directive.
+func (m *Message) AttachFS(fsys fs.FS, name string, inline bool) error {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return err
 	}
 
+	m.addAttachment(path.Base(name), data, inline)
+
 	return nil
 }
 
+// AttachSource attaches the content of src with the given filename. The
+// content is read each time the message is written.
+func (m *Message) AttachSource(filename string, src AttachmentSource, inline bool) {
+	m.setAttachment(filename, &Attachment{
+		Filename:    filename,
+		Inline:      inline,
+		ContentType: contentType(filename),
+		Source:      src,
+	})
+}
+
+func (m *Message) addAttachment(filename string, data []byte, inline bool) {
+	m.setAttachment(filename, &Attachment{
+		Filename:    filename,
+		Data:        data,
+		Inline:      inline,
+		ContentType: contentType(filename),
+	})
+}
+
+// unusedAttachmentName returns filename, or if an attachment already has
+// that name, filename with the first free numeric suffix, like
+// "logo-2.png".
+func (m *Message) unusedAttachmentName(filename string) string {
+	ext := path.Ext(filename)
+	base := strings.TrimSuffix(filename, ext)
+	name := filename
+	for i := 2; m.Attachments[name] != nil; i++ {
+		name = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+	return name
+}
+
+// setAttachment adds a to the attachments with the key name, keeping the
+// order in which they are added.
+func (m *Message) setAttachment(name string, a *Attachment) {
+	old, ok := m.Attachments[name]
+	if !ok {
+		m.order = append(m.order, name)
+	} else if src, spooled := old.Source.(*spoolSource); spooled && old.Source != a.Source {
+		src.release()
+	}
+	m.Attachments[name] = a
+}
+
+// attachmentNames returns the keys of the attachments in the order they
+// are written: the order in which they were added with the methods of
+// Message or set by SortAttachments, followed by the ones set directly in
+// the map sorted by name.
+func (m *Message) attachmentNames() []string {
+	names := make([]string, 0, len(m.Attachments))
+	seen := make(map[string]bool, len(m.Attachments))
+	for _, name := range m.order {
+		if _, ok := m.Attachments[name]; ok && !seen[name] {
+			names = append(names, name)
+			seen[name] = true
+		}
+	}
+	var others []string
+	for name := range m.Attachments {
+		if !seen[name] {
+			others = append(others, name)
+		}
+	}
+	sort.Strings(others)
+	return append(names, others...)
+}
+
+// attachmentList returns the attachments in the order they are written.
+func (m *Message) attachmentList() []*Attachment {
+	names := m.attachmentNames()
+	list := make([]*Attachment, len(names))
+	for i, name := range names {
+		list[i] = m.Attachments[name]
+	}
+	return list
+}
+
+// SortAttachments sorts the attachments with less, which reports whether
+// a must be written before b. The sort is stable, so the attachments that
+// are equal keep their order.
+func (m *Message) SortAttachments(less func(a, b *Attachment) bool) {
+	names := m.attachmentNames()
+	sort.SliceStable(names, func(i, j int) bool {
+		return less(m.Attachments[names[i]], m.Attachments[names[j]])
+	})
+	m.order = names
+}
+
+// contentType returns the MIME type of a file from its extension.
+func contentType(filename string) string {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if ext == ".eml" {
+		return "message/rfc822"
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// raw reports whether the attachment is written as is instead of base64
+// encoded, which is the case of inline messages.
+func (a *Attachment) raw() bool {
+	return a.Inline && (a.ContentType == "" || a.ContentType == "message/rfc822")
+}
+
 func (m *Message) Attach(file string) error {
 	return m.attach(file, false)
 }
@@ -59,6 +376,17 @@ func (m *Message) Inline(file string) error {
 	return m.attach(file, true)
 }
 
+// SetInline sets whether the attachment filename is written inline or as
+// a regular attachment.
+func (m *Message) SetInline(filename string, inline bool) error {
+	a, ok := m.Attachments[filename]
+	if !ok {
+		return fmt.Errorf("email: no attachment %s", filename)
+	}
+	a.Inline = inline
+	return nil
+}
+
 func newMessage(subject string, body string, bodyContentType string) *Message {
 	m := &Message{Subject: subject, Body: body, BodyContentType: bodyContentType}
 
@@ -77,9 +405,173 @@ func NewHTMLMessage(subject string, body string) *Message {
 	return newMessage(subject, body, "text/html")
 }
 
+// SetBodyTemplate sets the body to the result of executing tmpl with data
+// and its content type to text/html. The body is not modified if the
+// execution fails.
+func (m *Message) SetBodyTemplate(tmpl *template.Template, data interface{}) error {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return fmt.Errorf("email: executing template %s: %v", tmpl.Name(), err)
+	}
+	m.Body = b.String()
+	m.BodyContentType = "text/html"
+	return nil
+}
+
+// Clone returns a copy of m that can be modified without affecting m, for
+// example to customize a template message for each recipient from several
+// goroutines. The recipient and header slices, the Attachments map and the
+// attachments are copied, but the Data of the attachments is shared and
+// must not be modified in place. BodyReader is shared too. The copy holds
+// its own reference to the files of AttachReader, see RemoveSpooled.
+func (m *Message) Clone() *Message {
+	c := *m
+	c.To = append([]string(nil), m.To...)
+	c.Cc = append([]string(nil), m.Cc...)
+	c.Bcc = append([]string(nil), m.Bcc...)
+	c.Trace = append([]Header(nil), m.Trace...)
+	c.ExtraHeaders = append([]Header(nil), m.ExtraHeaders...)
+	c.References = append([]string(nil), m.References...)
+	c.AutoResponseSuppress = append([]string(nil), m.AutoResponseSuppress...)
+	c.Keywords = append([]string(nil), m.Keywords...)
+	c.ReadReceiptOptions = append([]MDNOption(nil), m.ReadReceiptOptions...)
+	c.Translations = append([]Translation(nil), m.Translations...)
+
+	if m.ListHeaders != nil {
+		c.ListHeaders = make(map[string]string, len(m.ListHeaders))
+		for k, v := range m.ListHeaders {
+			c.ListHeaders[k] = v
+		}
+	}
+
+	if m.OriginalRecipients != nil {
+		c.OriginalRecipients = make(map[string]string, len(m.OriginalRecipients))
+		for k, v := range m.OriginalRecipients {
+			c.OriginalRecipients[k] = v
+		}
+	}
+
+	if m.ValidSince != nil {
+		c.ValidSince = make(map[string]string, len(m.ValidSince))
+		for k, v := range m.ValidSince {
+			c.ValidSince[k] = v
+		}
+	}
+
+	c.order = append([]string(nil), m.order...)
+	c.Attachments = make(map[string]*Attachment, len(m.Attachments))
+	for k, v := range m.Attachments {
+		a := *v
+		if src, ok := a.Source.(*spoolSource); ok && !src.released {
+			a.Source = src.ref()
+		}
+		c.Attachments[k] = &a
+	}
+
+	return &c
+}
+
+// AddTo appends addrs to the To recipients
+func (m *Message) AddTo(addrs ...string) {
+	m.To = append(m.To, addrs...)
+}
+
+// AddCc appends addrs to the Cc recipients
+func (m *Message) AddCc(addrs ...string) {
+	m.Cc = append(m.Cc, addrs...)
+}
+
+// AddBcc appends addrs to the Bcc recipients
+func (m *Message) AddBcc(addrs ...string) {
+	m.Bcc = append(m.Bcc, addrs...)
+}
+
+// DefaultTraceHeaders are the headers usually kept when forwarding a message.
+var DefaultTraceHeaders = []string{"Received", "X-Original-To", "Delivered-To"}
+
+// PreserveHeaders appends the named headers of an inbound message to the
+// trace headers of m. Use DefaultTraceHeaders for the usual set.
+func (m *Message) PreserveHeaders(h mail.Header, names ...string) {
+	for _, name := range names {
+		name = textproto.CanonicalMIMEHeaderKey(name)
+		for _, v := range h[name] {
+			m.Trace = append(m.Trace, Header{Name: name, Value: v})
+		}
+	}
+}
+
+// SetAuthenticationResults prepends an Authentication-Results header
+// (RFC 8601) to the trace headers, recording the results of the checks
+// done by authservID, like "spf=pass smtp.mailfrom=example.com".
+func (m *Message) SetAuthenticationResults(authservID string, results ...string) {
+	value := authservID + "; none"
+	if len(results) > 0 {
+		value = authservID + ";\r\n\t" + strings.Join(results, ";\r\n\t")
+	}
+	h := Header{Name: "Authentication-Results", Value: value}
+	m.Trace = append([]Header{h}, m.Trace...)
+}
+
+// SetJSONHeader adds to ExtraHeaders the header name with the JSON
+// value data, like the X-SMTPAPI header of SendGrid. data is compacted and
+// folded after its commas to keep the lines short, and its non-ASCII
+// characters are escaped. It fails if data is not valid JSON or has a
+// string too long to fit in a line.
+func (m *Message) SetJSONHeader(name string, data []byte) error {
+	if name == "" || strings.IndexFunc(name, func(r rune) bool { return r <= ' ' || r > '~' || r == ':' }) >= 0 {
+		return fmt.Errorf("email: invalid header name %q", name)
+	}
+	var b bytes.Buffer
+	if err := json.Compact(&b, data); err != nil {
+		return fmt.Errorf("email: invalid JSON value of %s: %v", name, err)
+	}
+
+	var value strings.Builder
+	line := len(name) + 2
+	inString, escaped := false, false
+	for _, r := range b.String() {
+		switch {
+		case r > '~':
+			// non-ASCII characters can only be in strings
+			if r1, r2 := utf16.EncodeRune(r); r1 != unicode.ReplacementChar {
+				fmt.Fprintf(&value, "\\u%04x\\u%04x", r1, r2)
+				line += 12
+			} else {
+				fmt.Fprintf(&value, "\\u%04x", r)
+				line += 6
+			}
+		case escaped:
+			escaped = false
+			value.WriteRune(r)
+			line++
+		case r == '\\':
+			escaped = inString
+			value.WriteRune(r)
+			line++
+		case r == '"':
+			inString = !inString
+			value.WriteRune(r)
+			line++
+		default:
+			value.WriteRune(r)
+			line++
+			if r == ',' && !inString && line >= 76 {
+				value.WriteString("\r\n ")
+				line = 1
+			}
+		}
+		if line > 998 {
+			return fmt.Errorf("email: JSON value of %s can not be folded", name)
+		}
+	}
+	m.ExtraHeaders = append(m.ExtraHeaders, Header{Name: name, Value: value.String()})
+	return nil
+}
+
 // ToList returns all the recipients of the email
 func (m *Message) Tolist() []string {
-	tolist := m.To
+	tolist := make([]string, 0, len(m.To)+len(m.Cc)+len(m.Bcc))
+	tolist = append(tolist, m.To...)
 
 	for _, cc := range m.Cc {
 		tolist = append(tolist, cc)
@@ -92,72 +584,759 @@ func (m *Message) Tolist() []string {
 	return tolist
 }
 
-// Bytes returns the mail data
+// ErrMissingFrom is returned when the From address of a message is empty.
+var ErrMissingFrom = errors.New("email: From address is required")
+
+// MDNOption is a parameter of the Disposition-Notification-Options header,
+// like the protocol of a signed receipt: {"signed-receipt-protocol", false,
+// []string{"pkcs7-signature"}}. If Required is false the recipient may
+// ignore it.
+type MDNOption struct {
+	Name     string
+	Required bool
+	Values   []string
+}
+
+func (o MDNOption) String() string {
+	importance := "optional"
+	if o.Required {
+		importance = "required"
+	}
+	return o.Name + "=" + importance + ", " + strings.Join(o.Values, ",")
+}
+
+// Validate checks that the message has a valid From address and at least
+// one recipient, and that all the addresses are valid. With
+// StrictContentType it also checks the body.
+func (m *Message) Validate() error {
+	if m.From == "" {
+		return ErrMissingFrom
+	}
+	switch strings.ToLower(m.BodyEncoding) {
+	case "", "7bit", "8bit", "quoted-printable", "base64":
+	default:
+		return fmt.Errorf("email: unknown body encoding %q", m.BodyEncoding)
+	}
+	switch m.charset() {
+	case "utf-8", "iso-8859-1", "latin1", "us-ascii":
+	default:
+		return fmt.Errorf("email: unsupported charset %q", m.Charset)
+	}
+	switch m.Sensitivity {
+	case "", "Personal", "Private", "Company-Confidential":
+	default:
+		return fmt.Errorf("email: invalid sensitivity %q", m.Sensitivity)
+	}
+	if m.RequireTLS && m.TLSOptional {
+		return errors.New("email: RequireTLS and TLSOptional are exclusive")
+	}
+	if m.StrictContentType && m.BodyContentType == "text/plain" && looksLikeHTML(m.Body) {
+		return errors.New("email: text/plain body with HTML markup")
+	}
+	rcpts := m.Tolist()
+	if len(rcpts) == 0 {
+		return errors.New("email: at least one recipient is required")
+	}
+	addrs := append([]string{m.From}, rcpts...)
+	if m.EnvelopeFrom != "" {
+		addrs = append(addrs, m.EnvelopeFrom)
+	}
+	if m.ReadReceiptTo != "" {
+		addrs = append(addrs, m.ReadReceiptTo)
+	}
+	for _, addr := range addrs {
+		if strings.ContainsAny(addr, "\r\n") {
+			return errors.New("email: an address must not contain CR or LF")
+		}
+		if _, err := mail.ParseAddress(addr); err != nil {
+			return fmt.Errorf("email: invalid address %q: %v", addr, err)
+		}
+	}
+	return nil
+}
+
+// Bytes returns the mail data. It is nil if the message can not be
+// written, like a Strict message that breaks the rules, or one with an
+// attachment source that fails: use BytesErr to get the error.
 func (m *Message) Bytes() []byte {
+	data, _ := m.BytesErr()
+	return data
+}
+
+// BytesErr is like Bytes but returns the error of WriteTo.
+func (m *Message) BytesErr() ([]byte, error) {
 	buf := bytes.NewBuffer(nil)
+	if _, err := m.WriteTo(buf); err != nil {
+		return nil, err
+	}
+	return m.lineEndings(buf.Bytes()), nil
+}
+
+// lineEndings converts the CRLF line endings of data to LF if
+// UnixLineEndings is set.
+func (m *Message) lineEndings(data []byte) []byte {
+	if !m.UnixLineEndings {
+		return data
+	}
+	return bytes.Replace(data, []byte("\r\n"), []byte("\n"), -1)
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// randReader and nowFunc are the sources of the randomness and the time
+// of the written messages: the boundaries, the Date and the DKIMBodyHash
+// and mbox dates. They are variables so tests can replace them to get the
+// same bytes each time.
+var (
+	randReader = rand.Reader
+	nowFunc    = time.Now
+)
+
+// newBoundary returns a candidate multipart boundary. It is a variable so
+// tests can replace it.
+var newBoundary = randomBoundary
+
+func randomBoundary() string {
+	var buf [15]byte
+	if _, err := io.ReadFull(randReader, buf[:]); err != nil {
+		panic(err)
+	}
+	return fmt.Sprintf("%x", buf[:])
+}
+
+// The parts of the MIME tree of a message, from the outermost.
+const (
+	partMixed = iota
+	partMultilingual
+	partRelated
+	partAlternative
+	partBody
+)
+
+type boundaries struct {
+	mixed, multilingual, related, alt string
+}
+
+// envelopeSender returns the address of the MAIL FROM command: "" with
+// NullSender, otherwise EnvelopeFrom or From.
+func (m *Message) envelopeSender() string {
+	switch {
+	case m.NullSender:
+		return ""
+	case m.EnvelopeFrom != "":
+		return m.EnvelopeFrom
+	}
+	return m.From
+}
+
+// newBoundaries returns the boundaries of the multipart parts. They are
+// distinct and do not appear in the body or the attachments written as is.
+// A streamed body or attachment is not checked.
+func (m *Message) newBoundaries() boundaries {
+	if m.fixed != nil {
+		return *m.fixed
+	}
+	if m.innerPart(-1) == partBody {
+		// the common case of a single part message needs no boundaries
+		return boundaries{}
+	}
+	used := make(map[string]bool)
+	collides := func(b string) bool {
+		if used[b] || strings.Contains(m.Body, "--"+b) {
+			return true
+		}
+		for _, t := range m.Translations {
+			if strings.Contains(t.Body, "--"+b) {
+				return true
+			}
+		}
+		if m.DeliveryStatus != nil && bytes.Contains(m.DeliveryStatus.Headers, []byte("--"+b)) {
+			return true
+		}
+		for _, attachment := range m.attachmentList() {
+			if attachment.raw() && bytes.Contains(attachment.Data, []byte("--"+b)) {
+				return true
+			}
+		}
+		return false
+	}
+	next := func() string {
+		b := newBoundary()
+		for collides(b) {
+			b = newBoundary()
+		}
+		used[b] = true
+		return b
+	}
+
+	var b boundaries
+	b.mixed = next()
+	b.related = next()
+	b.alt = next()
+	if m.hasPart(partMultilingual) {
+		b.multilingual = next()
+	}
+	return b
+}
+
+// related reports whether a is written in the multipart/related part with
+// the body, so an HTML body can reference it with a cid: URL or its
+// Content-Location.
+func (m *Message) related(a *Attachment) bool {
+	return a.Inline && (a.ContentID != "" || a.ContentLocation != "") && !a.raw() && m.BodyContentType == "text/html"
+}
+
+// hasPart reports whether the MIME tree of the message has the part.
+func (m *Message) hasPart(part int) bool {
+	switch part {
+	case partMixed, partRelated:
+		if part == partMixed && m.DeliveryStatus != nil {
+			return true
+		}
+		for _, attachment := range m.attachmentList() {
+			if m.related(attachment) == (part == partRelated) {
+				return true
+			}
+		}
+		return false
+	case partMultilingual:
+		return len(m.Translations) > 0
+	case partAlternative:
+		return m.alternative()
+	}
+	return true
+}
+
+// attachmentsOnly reports whether the message has attachments and an
+// empty body, which is then omitted instead of written as an empty part.
+func (m *Message) attachmentsOnly() bool {
+	return m.Body == "" && m.BodyReader == nil && m.DeliveryStatus == nil &&
+		m.hasPart(partMixed) && m.innerPart(partMixed) == partBody
+}
+
+// innerPart returns the part of the MIME tree of the message that is
+// inside part, or the outermost part if part is -1.
+func (m *Message) innerPart(part int) int {
+	for p := part + 1; p < partBody; p++ {
+		if m.hasPart(p) {
+			return p
+		}
+	}
+	return partBody
+}
+
+func (m *Message) contentType(part int, b boundaries) string {
+	switch part {
+	case partMixed:
+		if m.DeliveryStatus != nil {
+			return "multipart/report; report-type=delivery-status; boundary=" + b.mixed
+		}
+		return "multipart/mixed; boundary=" + b.mixed
+	case partMultilingual:
+		return "multipart/multilingual; boundary=" + b.multilingual
+	case partRelated:
+		return "multipart/related; boundary=" + b.related
+	case partAlternative:
+		return "multipart/alternative; boundary=" + b.alt
+	}
+	return m.withCharset(m.BodyContentType)
+}
+
+// withCharset returns the media type t with the charset of the message,
+// unless it is not text, it already has a charset or OmitCharset is set.
+func (m *Message) withCharset(t string) string {
+	if m.OmitCharset || !strings.HasPrefix(strings.ToLower(t), "text/") ||
+		strings.Contains(strings.ToLower(t), "charset=") {
+		return t
+	}
+	return fmt.Sprintf("%s; charset=%s", t, m.charset())
+}
+
+// Headers returns the header block of the mail data, without the body and
+// the attachments. It is useful to log a message without its content.
+func (m *Message) Headers() []byte {
+	b := bytes.NewBuffer(nil)
+	buf := bufio.NewWriter(b)
+	m.writeHeaders(buf, m.newBoundaries())
+	buf.Flush()
+	return b.Bytes()
+}
+
+func (m *Message) writeHeaders(buf *bufio.Writer, b boundaries) {
+	if m.DKIMSignature != "" {
+		buf.WriteString("DKIM-Signature: " + m.DKIMSignature + "\r\n")
+	}
+	for _, h := range m.headerList(b) {
+		buf.WriteString(h.Name + ": " + h.Value + "\r\n")
+	}
+	buf.WriteString("\r\n")
+}
 
-	buf.WriteString("From: " + m.From + "\r\n")
+// HeaderList returns the headers of the message in the order they are
+// written, except DKIM-Signature, so a DKIM signer can choose the h= tag
+// and hash exactly the headers that are sent. The boundary in
+// Content-Type and the Date only match the ones written after
+// DKIMBodyHash, which fixes them.
+func (m *Message) HeaderList() []Header {
+	return m.headerList(m.newBoundaries())
+}
 
-	t := time.Now()
-	buf.WriteString("Date: " + t.Format(time.RFC822) + "\r\n")
+func (m *Message) headerList(b boundaries) []Header {
+	h := append([]Header(nil), m.Trace...)
+	add := func(name, value string) {
+		h = append(h, Header{Name: name, Value: value})
+	}
+
+	add("From", m.From)
+	if len(m.Sender) > 0 {
+		add("Sender", m.Sender)
+	}
+
+	t := m.date
+	if t.IsZero() {
+		t = nowFunc()
+	}
+	if m.Location != nil {
+		t = t.In(m.Location)
+	}
+	add("Date", t.Format(time.RFC1123Z))
+	if !m.Expires.IsZero() {
+		e := m.Expires
+		if m.Location != nil {
+			e = e.In(m.Location)
+		}
+		add("Expires", e.Format(time.RFC1123Z))
+		add("Expiry-Date", e.Format(time.RFC1123Z))
+	}
 
-	buf.WriteString("To: " + strings.Join(m.To, ",") + "\r\n")
+	add("To", strings.Join(m.To, ","))
 	if len(m.Cc) > 0 {
-		buf.WriteString("Cc: " + strings.Join(m.Cc, ",") + "\r\n")
+		add("Cc", strings.Join(m.Cc, ","))
 	}
 
-	buf.WriteString("Subject: " + m.Subject + "\r\n")
+	add("Subject", m.encodeWord(m.Subject))
+	if len(m.Comments) > 0 {
+		add("Comments", m.encodeWord(m.Comments))
+	}
+	if len(m.Keywords) > 0 {
+		words := make([]string, len(m.Keywords))
+		for i, k := range m.Keywords {
+			words[i] = m.encodeWord(k)
+		}
+		add("Keywords", strings.Join(words, ", "))
+	}
 
 	if len(m.ReplyTo) > 0 {
-		buf.WriteString("Reply-To: " + m.ReplyTo + "\r\n")
+		add("Reply-To", m.ReplyTo)
+	}
+
+	if len(m.MessageID) > 0 {
+		add("Message-ID", msgID(m.MessageID))
+	}
+
+	if len(m.InReplyTo) > 0 {
+		add("In-Reply-To", msgID(m.InReplyTo))
+	}
+
+	refs := m.References
+	if m.OriginalMessageID != "" {
+		add("X-Original-Message-ID", msgID(m.OriginalMessageID))
+		found := false
+		for _, id := range refs {
+			found = found || msgID(id) == msgID(m.OriginalMessageID)
+		}
+		if !found {
+			refs = append([]string{m.OriginalMessageID}, refs...)
+		}
+	}
+	if len(refs) > 0 {
+		ids := make([]string, len(refs))
+		for i, id := range refs {
+			ids[i] = msgID(id)
+		}
+		add("References", strings.Join(ids, " "))
 	}
 
-	buf.WriteString("MIME-Version: 1.0\r\n")
+	if len(m.Precedence) > 0 {
+		add("Precedence", m.Precedence)
+	}
 
-	boundary := "f46d043c813270fc6b04c2d223da"
+	if len(m.Sensitivity) > 0 {
+		add("Sensitivity", m.Sensitivity)
+	}
 
-	if len(m.Attachments) > 0 {
-		buf.WriteString("Content-Type: multipart/mixed; boundary=" + boundary + "\r\n")
-		buf.WriteString("--" + boundary + "\r\n")
+	if m.TLSOptional {
+		add("TLS-Required", "No")
 	}
 
-	buf.WriteString(fmt.Sprintf("Content-Type: %s; charset=utf-8\r\n\r\n", m.BodyContentType))
-	buf.WriteString(m.Body)
+	if len(m.ReadReceiptTo) > 0 {
+		add("Disposition-Notification-To", m.ReadReceiptTo)
+		if len(m.ReadReceiptOptions) > 0 {
+			options := make([]string, len(m.ReadReceiptOptions))
+			for i, o := range m.ReadReceiptOptions {
+				options[i] = o.String()
+			}
+			add("Disposition-Notification-Options", strings.Join(options, ";\r\n\t"))
+		}
+	}
+
+	if len(m.ReportAbuse) > 0 {
+		add("X-Report-Abuse", m.ReportAbuse)
+	}
+
+	if len(m.AutoResponseSuppress) > 0 {
+		add("X-Auto-Response-Suppress", strings.Join(m.AutoResponseSuppress, ", "))
+	}
+
+	for _, name := range m.sortedListHeaders() {
+		add(name, m.ListHeaders[name])
+	}
+
+	addrs := make([]string, 0, len(m.ValidSince))
+	for addr := range m.ValidSince {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	for _, addr := range addrs {
+		add("Require-Recipient-Valid-Since", addr+"; "+m.ValidSince[addr])
+	}
+
+	h = append(h, m.ExtraHeaders...)
+
+	add("MIME-Version", "1.0")
+	add("Content-Type", m.contentType(m.innerPart(-1), b))
+	if m.innerPart(-1) == partBody {
+		add("Content-Transfer-Encoding", m.bodyEncoding())
+		if d := m.bodyDisposition(); d != "" {
+			add("Content-Disposition", d)
+		}
+	}
+	return h
+}
+
+// partHeaderOrder is the order of the headers of the MIME parts. It is
+// fixed so the serialized message, and its DKIM body hash, does not
+// change between runs.
+var partHeaderOrder = []string{
+	"Content-Type",
+	"Content-Transfer-Encoding",
+	"Content-Disposition",
+	"Content-ID",
+	"Content-Location",
+	"Content-Description",
+	"Content-Language",
+	"Content-Translation-Type",
+	"X-Attachment-SHA256",
+}
+
+// writePartHeaders writes the headers h of a MIME part in the order of
+// partHeaderOrder, skipping the empty ones, and the blank line that ends
+// them.
+func writePartHeaders(buf *bufio.Writer, h map[string]string) {
+	for _, name := range partHeaderOrder {
+		if v := h[name]; v != "" {
+			buf.WriteString(name + ": " + v + "\r\n")
+		}
+	}
 	buf.WriteString("\r\n")
+}
 
-	if len(m.Attachments) > 0 {
-		for _, attachment := range m.Attachments {
-			buf.WriteString("\r\n\r\n--" + boundary + "\r\n")
+// partHeaders returns the Content-Type and, for the body, the
+// Content-Transfer-Encoding and Content-Disposition headers of part.
+func (m *Message) partHeaders(part int, b boundaries) map[string]string {
+	h := map[string]string{"Content-Type": m.contentType(part, b)}
+	if part == partBody {
+		h["Content-Transfer-Encoding"] = m.bodyEncoding()
+		h["Content-Disposition"] = m.bodyDisposition()
+	}
+	return h
+}
 
-			if attachment.Inline {
-				buf.WriteString("Content-Type: message/rfc822\r\n")
-				buf.WriteString("Content-Disposition: inline; filename=\"" + attachment.Filename + "\"\r\n\r\n")
+// bodyDisposition returns the Content-Disposition of the body part, or ""
+// if BodyFilename is not set.
+func (m *Message) bodyDisposition() string {
+	if m.BodyFilename == "" {
+		return ""
+	}
+	return "inline; " + m.filenameParam(m.BodyFilename)
+}
 
-				buf.Write(attachment.Data)
-			} else {
-				buf.WriteString("Content-Type: application/octet-stream\r\n")
-				buf.WriteString("Content-Transfer-Encoding: base64\r\n")
-				buf.WriteString("Content-Disposition: attachment; filename=\"" + attachment.Filename + "\"\r\n\r\n")
-
-				b := make([]byte, base64.StdEncoding.EncodedLen(len(attachment.Data)))
-				base64.StdEncoding.Encode(b, attachment.Data)
-
-				// write base64 content in lines of up to 76 chars
-				for i, l := 0, len(b); i < l; i++ {
-					buf.WriteByte(b[i])
-					if (i+1)%76 == 0 {
-						buf.WriteString("\r\n")
-					}
+// alternative reports whether the body is written as multipart/alternative.
+func (m *Message) alternative() bool {
+	return m.AutoPlainText && m.BodyContentType == "text/html"
+}
+
+// writePart writes the content of part, without its headers. If hashes is
+// not nil the SHA-256 of each attachment written is added to it.
+func (m *Message) writePart(buf *bufio.Writer, part int, b boundaries, hashes map[*Attachment][]byte) error {
+	switch part {
+	case partMixed, partRelated:
+		boundary := b.mixed
+		if part == partRelated {
+			boundary = b.related
+		}
+
+		inner := m.innerPart(part)
+		if part != partMixed || !m.attachmentsOnly() {
+			buf.WriteString("--" + boundary + "\r\n")
+			writePartHeaders(buf, m.partHeaders(inner, b))
+			if err := m.writePart(buf, inner, b, hashes); err != nil {
+				return err
+			}
+		}
+		if part == partMixed && m.DeliveryStatus != nil {
+			m.DeliveryStatus.write(buf, b.mixed)
+		}
+
+		for _, attachment := range m.attachmentList() {
+			if m.related(attachment) == (part == partRelated) {
+				buf.WriteString("--" + boundary + "\r\n")
+				if err := m.writeAttachment(buf, attachment, hashes); err != nil {
+					return err
 				}
 			}
+		}
+
+		buf.WriteString("--" + boundary + "--\r\n")
+		return nil
+
+	case partMultilingual:
+		return m.writeMultilingual(buf, b)
+
+	case partAlternative:
+		body := m.transcode(m.Body)
+		text := m.transcode(htmlToText(m.Body))
+		if m.BodyReader != nil {
+			data, err := ioutil.ReadAll(m.BodyReader)
+			if err != nil {
+				return err
+			}
+			body = string(data)
+			text = htmlToText(body)
+		}
+
+		text = strings.Replace(text, "\n", "\r\n", -1)
+		buf.WriteString("--" + b.alt + "\r\n")
+		writePartHeaders(buf, map[string]string{
+			"Content-Type":              m.withCharset("text/plain"),
+			"Content-Transfer-Encoding": m.encoding(text),
+		})
+		if err := writeEncoded(buf, m.encoding(text), strings.NewReader(text)); err != nil {
+			return err
+		}
+		buf.WriteString("--" + b.alt + "\r\n")
+		writePartHeaders(buf, map[string]string{
+			"Content-Type":              m.contentType(partBody, b),
+			"Content-Transfer-Encoding": m.encoding(body),
+			"Content-Disposition":       m.bodyDisposition(),
+		})
+		if err := writeEncoded(buf, m.encoding(body), strings.NewReader(body)); err != nil {
+			return err
+		}
+		buf.WriteString("--" + b.alt + "--\r\n")
+		return nil
+	}
 
-			buf.WriteString("\r\n--" + boundary)
+	if m.BodyReader != nil {
+		return writeEncoded(buf, m.bodyEncoding(), m.BodyReader)
+	}
+	return writeEncoded(buf, m.bodyEncoding(), strings.NewReader(m.transcode(m.Body)))
+}
+
+// lastByteWriter is a writer that remembers the last byte written.
+type lastByteWriter struct {
+	w    io.Writer
+	last byte
+}
+
+func (lw *lastByteWriter) Write(p []byte) (int, error) {
+	n, err := lw.w.Write(p)
+	if n > 0 {
+		lw.last = p[n-1]
+	}
+	return n, err
+}
+
+func (m *Message) writeAttachment(buf *bufio.Writer, attachment *Attachment, hashes map[*Attachment][]byte) error {
+	r := io.Reader(bytes.NewReader(attachment.Data))
+	if attachment.Source != nil {
+		rc, err := attachment.Source.Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		r = rc
+	}
+	if hashes != nil {
+		// the content is hashed as it is encoded, so it is read only once
+		h := sha256.New()
+		r = io.TeeReader(r, h)
+		defer func() { hashes[attachment] = h.Sum(nil) }()
+	}
+
+	headers := map[string]string{
+		"Content-Location":    attachment.ContentLocation,
+		"Content-Description": m.encodeWord(attachment.Description),
+	}
+	if attachment.ContentID != "" {
+		headers["Content-ID"] = msgID(attachment.ContentID)
+	}
+	if m.AttachmentHashHeader && attachment.Source == nil {
+		sum := sha256.Sum256(attachment.Data)
+		headers["X-Attachment-SHA256"] = hex.EncodeToString(sum[:])
+	}
+
+	if attachment.raw() {
+		headers["Content-Type"] = "message/rfc822"
+		headers["Content-Disposition"] = "inline; " + m.filenameParam(attachment.Filename) + attachment.dates()
+		writePartHeaders(buf, headers)
+
+		if _, err := io.Copy(buf, r); err != nil {
+			return err
 		}
+		buf.WriteString("\r\n")
+		return nil
+	}
+
+	contentType := attachment.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	disposition := "attachment"
+	if attachment.Inline {
+		disposition = "inline"
+	}
+
+	headers["Content-Type"] = contentType
+	headers["Content-Transfer-Encoding"] = "base64"
+	headers["Content-Disposition"] = disposition + "; " + m.filenameParam(attachment.Filename) + attachment.dates()
+	writePartHeaders(buf, headers)
+
+	lw := &lineWriter{w: buf}
+	enc := base64.NewEncoder(base64.StdEncoding, lw)
+	if _, err := io.Copy(enc, r); err != nil {
+		return err
+	}
+	enc.Close()
+	if lw.n > 0 {
+		buf.WriteString("\r\n")
+	}
+	return nil
+}
+
+// dates returns the date parameters of the Content-Disposition.
+func (a *Attachment) dates() string {
+	var s string
+	if !a.CreationDate.IsZero() {
+		s += "; creation-date=\"" + a.CreationDate.Format(time.RFC1123Z) + "\""
+	}
+	if !a.ModificationDate.IsZero() {
+		s += "; modification-date=\"" + a.ModificationDate.Format(time.RFC1123Z) + "\""
+	}
+	return s
+}
+
+// lineWriter writes base64 content in lines of up to 76 chars.
+type lineWriter struct {
+	w *bufio.Writer
+	n int // length of the current line
+}
 
-		buf.WriteString("--")
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		if lw.n == 76 {
+			lw.w.WriteString("\r\n")
+			lw.n = 0
+		}
+		i := 76 - lw.n
+		if i > len(p) {
+			i = len(p)
+		}
+		lw.w.Write(p[:i])
+		lw.n += i
+		p = p[i:]
 	}
+	return written, nil
+}
 
-	return buf.Bytes()
+// WriteTo writes the mail data to w. It implements io.WriterTo. With
+// Strict the message is checked before anything is written.
+func (m *Message) WriteTo(w io.Writer) (int64, error) {
+	return m.writeToHashes(w, nil)
+}
+
+// WriteToWithHashes is like WriteTo but also returns the SHA-256 hashes of
+// the content of the attachments by key, so recipients can verify them,
+// for example with a manifest sent separately. The hashes are computed as
+// the attachments are encoded, without reading them again.
+func (m *Message) WriteToWithHashes(w io.Writer) (int64, map[string][]byte, error) {
+	sums := make(map[*Attachment][]byte, len(m.Attachments))
+	n, err := m.writeToHashes(w, sums)
+	if err != nil {
+		return n, nil, err
+	}
+	hashes := make(map[string][]byte, len(sums))
+	for name, a := range m.Attachments {
+		if sum, ok := sums[a]; ok {
+			hashes[name] = sum
+		}
+	}
+	return n, hashes, nil
+}
+
+// writeToHashes implements WriteTo, adding the hashes of the attachments
+// to hashes if it is not nil.
+func (m *Message) writeToHashes(w io.Writer, hashes map[*Attachment][]byte) (int64, error) {
+	if !m.Strict {
+		return m.writeTo(w, hashes)
+	}
+	var b bytes.Buffer
+	if _, err := m.writeTo(&b, hashes); err != nil {
+		return 0, err
+	}
+	if err := checkStrict(b.Bytes()); err != nil {
+		return 0, err
+	}
+	return b.WriteTo(w)
+}
+
+func (m *Message) writeTo(w io.Writer, hashes map[*Attachment][]byte) (int64, error) {
+	if m.plainASCII() {
+		return m.writePlain(w)
+	}
+	return m.writeMIME(w, hashes)
+}
+
+// writeMIME writes the message with its MIME tree, the general path of
+// writeTo.
+func (m *Message) writeMIME(w io.Writer, hashes map[*Attachment][]byte) (int64, error) {
+	cw := &countWriter{w: w}
+	buf := bufio.NewWriter(cw)
+
+	b := m.newBoundaries()
+	m.writeHeaders(buf, b)
+
+	if err := m.writePart(buf, m.innerPart(-1), b, hashes); err != nil {
+		return cw.n, err
+	}
+
+	err := buf.Flush()
+	return cw.n, err
+}
+
+// msgID returns id between angle brackets.
+func msgID(id string) string {
+	return "<" + strings.Trim(id, "<>") + ">"
 }
 
 type loginAuth struct {
@@ -197,58 +1376,12 @@ func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
 
 	command := strings.ToLower(strings.TrimSuffix(string(fromServer), ":"))
 	switch command {
+	// the responses are returned as is, smtp.Client encodes them in base64
 	case "username":
-		return []byte(fmt.Sprintf("%s", a.username)), nil
+		return []byte(a.username), nil
 	case "password":
-		return []byte(fmt.Sprintf("%s", a.password)), nil
+		return []byte(a.password), nil
 	default:
 		return nil, fmt.Errorf("LoginAuth: unexpected server challenge: %s", command)
 	}
 }
-
-// Added skipverify parameter in order to skip TLS cert validation (insecure).
-func Send(addr string, auth smtp.Auth, m *Message, skipverify bool) error {
-	c, err := smtp.Dial(addr)
-	if err != nil {
-		return err
-	}
-	defer c.Close()
-	host, _, _ := net.SplitHostPort(addr)
-	if err = c.Hello(host); err != nil {
-		return err
-	}
-	if ok, _ := c.Extension("STARTTLS"); ok {
-		config := &tls.Config{ServerName: host, InsecureSkipVerify: skipverify}
-		if err = c.StartTLS(config); err != nil {
-			return err
-		}
-	}
-	if auth != nil {
-		if ok, _ := c.Extension("AUTH"); ok {
-                       if err = c.Auth(auth); err != nil {
-                               return err
-                       }
-		}
-	}
-	if err = c.Mail(m.From); err != nil {
-		return err
-	}
-	for _, to := range m.Tolist() {
-		if err = c.Rcpt(to); err != nil {
-			return err
-		}
-	}
-	w, err := c.Data()
-	if err != nil {
-		return err
-	}
-	_, err = w.Write(m.Bytes())
-	if err != nil {
-		return err
-	}
-	err = w.Close()
-	if err != nil {
-		return err
-	}
-	return c.Quit()
-}
@@ -1,8 +1,24 @@
 package email
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	mrand "math/rand"
+	"mime"
+	"mime/multipart"
+	"net/mail"
 	"net/smtp"
+	"path/filepath"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 )
 
 func TestSend(t *testing.T) {
@@ -22,3 +38,924 @@ func TestSend(t *testing.T) {
 		panic(err)
 	}
 }
+
+func TestBodyReader(t *testing.T) {
+	m := NewMessage("Hi", "this is the body")
+	m.BodyReader = strings.NewReader("this is the streamed body")
+
+	data := string(m.Bytes())
+	if !strings.Contains(data, "this is the streamed body") {
+		t.Fatalf("streamed body not found in message:\n%s", data)
+	}
+	if strings.Contains(data, "this is the body") {
+		t.Fatalf("Body written although BodyReader is set:\n%s", data)
+	}
+}
+
+func TestSetBodyTemplate(t *testing.T) {
+	tmpl := template.Must(template.New("welcome").Parse(`<p>Hello {{.Name}}</p>{{index .Items 5}}`))
+
+	m := NewMessage("Hi", "this is the body")
+	if err := m.SetBodyTemplate(tmpl, map[string]interface{}{"Name": "<Bob>", "Items": []int{1}}); err == nil {
+		t.Fatal("expected an execution error")
+	}
+	if m.Body != "this is the body" || m.BodyContentType != "text/plain" {
+		t.Fatalf("body modified on error: %q", m.Body)
+	}
+
+	tmpl = template.Must(template.New("welcome").Parse(`<p>Hello {{.Name}}</p>`))
+	if err := m.SetBodyTemplate(tmpl, map[string]interface{}{"Name": "<Bob>"}); err != nil {
+		t.Fatal(err)
+	}
+	if m.Body != "<p>Hello &lt;Bob&gt;</p>" || m.BodyContentType != "text/html" {
+		t.Fatalf("unexpected body %q of type %s", m.Body, m.BodyContentType)
+	}
+}
+
+func TestBodyTrailingNewline(t *testing.T) {
+	for _, body := range []string{"body", "body\r\n"} {
+		m := NewMessage("Hi", body)
+		if data := string(m.Bytes()); !strings.HasSuffix(data, "\r\n\r\nbody\r\n") {
+			t.Fatalf("unexpected end of the message with body %q: %q", body, data[len(data)-20:])
+		}
+
+		m.BodyReader = strings.NewReader(body)
+		if data := string(m.Bytes()); !strings.HasSuffix(data, "\r\n\r\nbody\r\n") {
+			t.Fatalf("unexpected end of the message with BodyReader %q: %q", body, data[len(data)-20:])
+		}
+
+		m = NewHTMLMessage("Hi", body)
+		m.AutoPlainText = true
+		m.Attachments["a.txt"] = &Attachment{Filename: "a.txt", Data: []byte("attachment")}
+		data := string(m.Bytes())
+		if i := strings.Index(data, "7bit\r\n\r\nbody"); i < 0 || !strings.HasPrefix(data[i+len("7bit\r\n\r\n"):], "body\r\n--") {
+			t.Fatalf("unexpected end of the parts with body %q:\n%s", body, data)
+		}
+		if err := m.SelfCheck(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestAddRecipients(t *testing.T) {
+	m := NewMessage("Hi", "this is the body")
+	m.AddTo("to1@example.com", "Name <to2@example.com>")
+	m.AddCc("cc@example.com")
+	m.AddBcc("bcc@example.com")
+
+	if len(m.To) != 2 || m.To[1] != "Name <to2@example.com>" {
+		t.Fatalf("unexpected To: %v", m.To)
+	}
+	if len(m.Tolist()) != 4 {
+		t.Fatalf("unexpected recipients: %v", m.Tolist())
+	}
+}
+
+func TestValidate(t *testing.T) {
+	m := NewMessage("Hi", "this is the body")
+	m.To = []string{"to@example.com"}
+	if err := m.Validate(); err != ErrMissingFrom {
+		t.Fatalf("expected ErrMissingFrom, got %v", err)
+	}
+
+	m.From = "from@example.com"
+	if err := m.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, addr := range []string{"not an address", "to@example.com\r\nBcc: x@example.com"} {
+		c := m.Clone()
+		c.AddBcc(addr)
+		if err := c.Validate(); err == nil {
+			t.Fatalf("expected an error for %q", addr)
+		}
+	}
+	m.To = nil
+	if err := m.Validate(); err == nil {
+		t.Fatal("expected an error without recipients")
+	}
+
+	// Send fails before connecting
+	m = NewMessage("Hi", "this is the body")
+	m.To = []string{"to@example.com"}
+	if err := Send("127.0.0.1:0", nil, m, false); err != ErrMissingFrom {
+		t.Fatalf("expected ErrMissingFrom, got %v", err)
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	m := NewMessage("Hi", "this is the body")
+	m.From = "from@example.com"
+	m.To = []string{"to@example.com"}
+	m.Attachments["secret.txt"] = &Attachment{Filename: "secret.txt", Data: []byte("secret data")}
+
+	h := string(m.Headers())
+	if !strings.Contains(h, "Subject: Hi\r\n") || !strings.Contains(h, "To: to@example.com\r\n") {
+		t.Fatalf("missing headers:\n%s", h)
+	}
+	if !strings.HasSuffix(h, "\r\n\r\n") {
+		t.Fatalf("header block not terminated:\n%s", h)
+	}
+	if strings.Contains(h, "this is the body") || strings.Contains(h, "secret.txt") {
+		t.Fatalf("headers contain message content:\n%s", h)
+	}
+}
+
+func TestPreserveHeaders(t *testing.T) {
+	raw := "Received: from a.example.com by b.example.com\r\n" +
+		"Received: from c.example.com by a.example.com\r\n" +
+		"Delivered-To: list@example.com\r\n" +
+		"X-Spam: no\r\n" +
+		"Subject: Hi\r\n\r\nbody"
+
+	in, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewMessage("Fwd: Hi", "body")
+	m.PreserveHeaders(in.Header, DefaultTraceHeaders...)
+
+	h := string(m.Headers())
+	want := "Received: from a.example.com by b.example.com\r\n" +
+		"Received: from c.example.com by a.example.com\r\n" +
+		"Delivered-To: list@example.com\r\n" +
+		"From: "
+	if !strings.HasPrefix(h, want) {
+		t.Fatalf("trace headers not preserved:\n%s", h)
+	}
+	if strings.Contains(h, "X-Spam") {
+		t.Fatalf("unexpected header preserved:\n%s", h)
+	}
+}
+
+func TestBoundaryCollision(t *testing.T) {
+	candidates := []string{"collide", "collide", "mixed", "mixed", "related", "alt"}
+	defer func(f func() string) { newBoundary = f }(newBoundary)
+	newBoundary = func() string {
+		b := candidates[0]
+		candidates = candidates[1:]
+		return b
+	}
+
+	m := NewHTMLMessage("Hi", "<p>a line like --collide in the body</p>")
+	m.AutoPlainText = true
+	m.From = "from@example.com"
+	m.To = []string{"to@example.com"}
+	m.Attachments["a.txt"] = &Attachment{Filename: "a.txt", Data: []byte("attachment")}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(m.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mediaType != "multipart/mixed" || params["boundary"] != "mixed" {
+		t.Fatalf("unexpected Content-Type %q", msg.Header.Get("Content-Type"))
+	}
+
+	r := multipart.NewReader(msg.Body, params["boundary"])
+	body, err := r.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, params, _ := mime.ParseMediaType(body.Header.Get("Content-Type")); params["boundary"] != "alt" {
+		t.Fatalf("unexpected body Content-Type %q", body.Header.Get("Content-Type"))
+	}
+	alt := multipart.NewReader(body, "alt")
+	for i := 0; i < 2; i++ {
+		if _, err := alt.NextPart(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := alt.NextPart(); err != io.EOF {
+		t.Fatalf("expected the end of the alternative parts, got %v", err)
+	}
+	p, err := r.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.FileName() != "a.txt" {
+		t.Fatalf("unexpected attachment %q", p.FileName())
+	}
+	if _, err := r.NextPart(); err != io.EOF {
+		t.Fatalf("expected the end of the message, got %v", err)
+	}
+}
+
+func TestAttachmentContentID(t *testing.T) {
+	m := NewMessage("Hi", "this is the body")
+	m.Attachments["a.pdf"] = &Attachment{Filename: "a.pdf", Data: []byte("pdf"), ContentID: "part1.a@example.com"}
+	m.Attachments["b.pdf"] = &Attachment{Filename: "b.pdf", Data: []byte("pdf")}
+
+	data := string(m.Bytes())
+	if strings.Count(data, "Content-ID:") != 1 || !strings.Contains(data, "Content-ID: <part1.a@example.com>\r\n") {
+		t.Fatalf("unexpected Content-ID headers:\n%s", data)
+	}
+}
+
+func TestAttachmentContentLocation(t *testing.T) {
+	m := NewHTMLMessage("Hi", `<img src="images/logo.png">`)
+	m.Attachments["logo.png"] = &Attachment{
+		Filename:        "logo.png",
+		Data:            []byte("png"),
+		Inline:          true,
+		ContentType:     "image/png",
+		ContentLocation: "images/logo.png",
+	}
+
+	data := string(m.Bytes())
+	if !strings.Contains(data, "Content-Type: multipart/related; boundary=") ||
+		!strings.Contains(data, "Content-Disposition: inline; filename=\"logo.png\"\r\nContent-Location: images/logo.png\r\n") {
+		t.Fatalf("missing related part with Content-Location:\n%s", data)
+	}
+}
+
+// countingSource is an AttachmentSource that counts how many times it is
+// opened.
+type countingSource struct {
+	data  string
+	opens int
+}
+
+func (s *countingSource) Open() (io.ReadCloser, error) {
+	s.opens++
+	return ioutil.NopCloser(strings.NewReader(s.data)), nil
+}
+
+func TestWriteToWithHashes(t *testing.T) {
+	src := &countingSource{data: "streamed"}
+	m := NewMessage("Hi", "this is the body")
+	m.Attachments["a.txt"] = &Attachment{Filename: "a.txt", Data: []byte("attachment")}
+	m.AttachSource("b.bin", src, false)
+	m.Attachments["c.eml"] = &Attachment{Filename: "c.eml", Data: []byte("Subject: Hi\r\n\r\nbody"), Inline: true}
+
+	var buf bytes.Buffer
+	n, hashes, err := m.WriteToWithHashes(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) {
+		t.Fatalf("expected %d bytes written, got %d", buf.Len(), n)
+	}
+	if src.opens != 1 {
+		t.Fatalf("expected the source to be opened once, got %d", src.opens)
+	}
+	for name, data := range map[string]string{"a.txt": "attachment", "b.bin": "streamed", "c.eml": "Subject: Hi\r\n\r\nbody"} {
+		want := sha256.Sum256([]byte(data))
+		if got := hashes[name]; !bytes.Equal(got, want[:]) {
+			t.Fatalf("hash of %s: got %x, want %x", name, got, want)
+		}
+	}
+	if strings.Contains(buf.String(), "X-Attachment-SHA256") {
+		t.Fatalf("unexpected hash header:\n%s", buf.String())
+	}
+}
+
+func TestAttachmentHashHeader(t *testing.T) {
+	m := NewMessage("Hi", "this is the body")
+	m.AttachmentHashHeader = true
+	m.Attachments["a.txt"] = &Attachment{Filename: "a.txt", Data: []byte("attachment")}
+	m.AttachSource("b.bin", &countingSource{data: "streamed"}, false)
+	data := string(m.Bytes())
+
+	sum := sha256.Sum256([]byte("attachment"))
+	want := "Content-Disposition: attachment; filename=\"a.txt\"\r\nX-Attachment-SHA256: " + hex.EncodeToString(sum[:]) + "\r\n\r\n"
+	if !strings.Contains(data, want) {
+		t.Fatalf("missing %q in:\n%s", want, data)
+	}
+	if strings.Count(data, "X-Attachment-SHA256") != 1 {
+		t.Fatalf("expected no hash header for the streamed attachment:\n%s", data)
+	}
+}
+
+func TestAttachmentDescription(t *testing.T) {
+	m := NewMessage("Hi", "this is the body")
+	m.Attachments["a.pdf"] = &Attachment{Filename: "a.pdf", Data: []byte("pdf"), Description: "Quarterly report"}
+	m.Attachments["b.pdf"] = &Attachment{Filename: "b.pdf", Data: []byte("pdf"), Description: "Résumé"}
+
+	data := string(m.Bytes())
+	for _, want := range []string{
+		"Content-Description: Quarterly report\r\n",
+		"Content-Description: =?utf-8?b?UsOpc3Vtw6k=?=\r\n",
+	} {
+		if !strings.Contains(data, want) {
+			t.Fatalf("missing %q in:\n%s", want, data)
+		}
+	}
+	if err := m.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAttachmentDates(t *testing.T) {
+	est := time.FixedZone("EST", -5*3600)
+	m := NewMessage("Hi", "this is the body")
+	m.Attachments["a.pdf"] = &Attachment{
+		Filename:         "a.pdf",
+		Data:             []byte("pdf"),
+		CreationDate:     time.Date(1997, 2, 12, 16, 29, 51, 0, est),
+		ModificationDate: time.Date(1997, 2, 13, 8, 0, 0, 0, time.UTC),
+	}
+	m.Attachments["b.pdf"] = &Attachment{Filename: "b.pdf", Data: []byte("pdf")}
+
+	data := string(m.Bytes())
+	for _, want := range []string{
+		"Content-Disposition: attachment; filename=\"a.pdf\"; creation-date=\"Wed, 12 Feb 1997 16:29:51 -0500\"; modification-date=\"Thu, 13 Feb 1997 08:00:00 +0000\"\r\n",
+		"Content-Disposition: attachment; filename=\"b.pdf\"\r\n",
+	} {
+		if !strings.Contains(data, want) {
+			t.Fatalf("missing %q in:\n%s", want, data)
+		}
+	}
+}
+
+func TestSetAuthenticationResults(t *testing.T) {
+	m := NewMessage("Hi", "this is the body")
+	m.Trace = []Header{{Name: "Received", Value: "from a.example.com by b.example.com"}}
+	m.SetAuthenticationResults("mx.example.com", "spf=pass smtp.mailfrom=example.org", "dkim=pass header.d=example.org")
+
+	want := "Authentication-Results: mx.example.com;\r\n" +
+		"\tspf=pass smtp.mailfrom=example.org;\r\n" +
+		"\tdkim=pass header.d=example.org\r\n" +
+		"Received: from a.example.com by b.example.com\r\n"
+	if h := string(m.Headers()); !strings.HasPrefix(h, want) {
+		t.Fatalf("unexpected headers:\n%s", h)
+	}
+
+	m = NewMessage("Hi", "this is the body")
+	m.SetAuthenticationResults("mx.example.com")
+	if h := string(m.Headers()); !strings.HasPrefix(h, "Authentication-Results: mx.example.com; none\r\n") {
+		t.Fatalf("unexpected headers:\n%s", h)
+	}
+}
+
+func TestAttachFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"assets/logo.png":   {Data: []byte("\x89PNG")},
+		"assets/report.pdf": {Data: []byte("%PDF")},
+	}
+
+	m := NewMessage("Hi", "this is the body")
+	if err := m.AttachFS(fsys, "assets/logo.png", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AttachFS(fsys, "assets/report.pdf", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AttachFS(fsys, "assets/missing.txt", false); err == nil {
+		t.Fatal("expected an error for a missing file")
+	}
+
+	data := string(m.Bytes())
+	for _, want := range []string{
+		"Content-Type: image/png\r\nContent-Transfer-Encoding: base64\r\nContent-Disposition: inline; filename=\"logo.png\"\r\n",
+		"Content-Type: application/pdf\r\nContent-Transfer-Encoding: base64\r\nContent-Disposition: attachment; filename=\"report.pdf\"\r\n",
+	} {
+		if !strings.Contains(data, want) {
+			t.Fatalf("missing %q in:\n%s", want, data)
+		}
+	}
+}
+
+func TestAttachSource(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 100)
+	file := filepath.Join(t.TempDir(), "big.bin")
+	if err := ioutil.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(f func() string) { newBoundary = f }(newBoundary)
+	n := 0
+	newBoundary = func() string {
+		n++
+		return fmt.Sprint("boundary", n%3)
+	}
+
+	m := NewMessage("Hi", "this is the body")
+	m.AttachSource("big.bin", FileSource(file), false)
+	c := m.Clone()
+	c.Attachments["big.bin"] = &Attachment{Filename: "big.bin", Data: data, ContentType: "application/octet-stream"}
+	for i := 0; i < 2; i++ {
+		if got, want := m.Bytes(), c.Bytes(); !bytes.Equal(got, want) {
+			t.Fatalf("streamed attachment differs:\n%s\nwant:\n%s", got, want)
+		}
+	}
+
+	m.Attachments["big.bin"].Source = FileSource(file + ".missing")
+	if _, err := m.WriteTo(ioutil.Discard); err == nil {
+		t.Fatal("expected an error for a missing file")
+	}
+}
+
+// BenchmarkInlineImage writes a message with a large inline image, read
+// into memory or streamed from the file.
+func BenchmarkInlineImage(b *testing.B) {
+	file := filepath.Join(b.TempDir(), "image.png")
+	if err := ioutil.WriteFile(file, make([]byte, 4<<20), 0644); err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("Data", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			m := NewHTMLMessage("Hi", `<img src="cid:image">`)
+			if err := m.Inline(file); err != nil {
+				b.Fatal(err)
+			}
+			m.WriteTo(ioutil.Discard)
+		}
+	})
+	b.Run("Source", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			m := NewHTMLMessage("Hi", `<img src="cid:image">`)
+			m.AttachSource("image.png", FileSource(file), true)
+			m.WriteTo(ioutil.Discard)
+		}
+	})
+}
+
+// BenchmarkWriteTo compares a plain ASCII message, which takes the fast
+// path of plainASCII, with the same message written by the general path
+// and with an attachment.
+func BenchmarkWriteTo(b *testing.B) {
+	m := NewMessage("Your order has shipped", strings.Repeat("Your order 1234 is on its way.\r\n", 20))
+	m.From = "shop@example.com"
+	m.To = []string{"customer@example.com"}
+
+	b.Run("Plain", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			m.WriteTo(ioutil.Discard)
+		}
+	})
+	b.Run("General", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			m.writeMIME(ioutil.Discard, nil)
+		}
+	})
+	b.Run("Multipart", func(b *testing.B) {
+		m := m.Clone()
+		m.Attachments["a.txt"] = &Attachment{Filename: "a.txt", Data: []byte("a")}
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			m.WriteTo(ioutil.Discard)
+		}
+	})
+}
+
+func TestWritePlain(t *testing.T) {
+	defer func(now func() time.Time) { nowFunc = now }(nowFunc)
+	nowFunc = func() time.Time { return time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC) }
+
+	plain := func() *Message {
+		m := NewMessage("Your order has shipped", "Your order 1234 is on its way.\r\nThanks")
+		m.From = "Shop <shop@example.com>"
+		m.To = []string{"a@example.com", "b@example.com"}
+		return m
+	}
+	for name, edit := range map[string]func(m *Message){
+		"basic": func(m *Message) {},
+		"headers": func(m *Message) {
+			m.Cc = []string{"c@example.com"}
+			m.ReplyTo = "support@example.com"
+			m.MessageID = "1234@example.com"
+			m.Location = time.FixedZone("CET", 3600)
+		},
+		"charset":    func(m *Message) { m.Charset = "ISO-8859-1" },
+		"no charset": func(m *Message) { m.OmitCharset = true },
+		"empty body": func(m *Message) { m.Body = "" },
+		"lf body":    func(m *Message) { m.Body = "line\nline\n" },
+	} {
+		m := plain()
+		edit(m)
+		if !m.plainASCII() {
+			t.Fatalf("%s: expected the fast path", name)
+		}
+		var fast, general bytes.Buffer
+		if _, err := m.WriteTo(&fast); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := m.writeMIME(&general, nil); err != nil {
+			t.Fatal(err)
+		}
+		if fast.String() != general.String() {
+			t.Fatalf("%s: fast path wrote\n%s\ninstead of\n%s", name, fast.String(), general.String())
+		}
+	}
+
+	for name, edit := range map[string]func(m *Message){
+		"subject":    func(m *Message) { m.Subject = "Crème brûlée" },
+		"body":       func(m *Message) { m.Body = "Crème brûlée" },
+		"long line":  func(m *Message) { m.Body = strings.Repeat("a", 999) },
+		"attachment": func(m *Message) { m.Attachments["a.txt"] = &Attachment{Filename: "a.txt", Data: []byte("a")} },
+		"html":       func(m *Message) { m.BodyContentType = "text/html" },
+		"header":     func(m *Message) { m.ExtraHeaders = []Header{{"X-Campaign", "1"}} },
+	} {
+		m := plain()
+		edit(m)
+		if m.plainASCII() {
+			t.Fatalf("%s: unexpected fast path", name)
+		}
+	}
+}
+
+func TestClone(t *testing.T) {
+	m := NewMessage("Hi", "this is the body")
+	m.To = []string{"to@example.com"}
+	m.Attachments["a.txt"] = &Attachment{Filename: "a.txt", Data: []byte("a")}
+
+	c := m.Clone()
+	c.To[0] = "other@example.com"
+	c.AddCc("cc@example.com")
+	c.Attachments["a.txt"].Inline = true
+	c.Attachments["b.txt"] = &Attachment{Filename: "b.txt"}
+
+	if m.To[0] != "to@example.com" || len(m.Cc) != 0 {
+		t.Fatalf("recipients of the original modified: %v %v", m.To, m.Cc)
+	}
+	if m.Attachments["a.txt"].Inline || len(m.Attachments) != 1 {
+		t.Fatal("attachments of the original modified")
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	m := NewMessage("Hi", "this is the body")
+	if strings.Contains(string(m.Headers()), "Precedence:") {
+		t.Fatal("Precedence written by default")
+	}
+
+	m.Precedence = "bulk"
+	if !strings.Contains(string(m.Headers()), "Precedence: bulk\r\n") {
+		t.Fatalf("missing Precedence:\n%s", m.Headers())
+	}
+}
+
+func TestAutoResponseSuppress(t *testing.T) {
+	m := NewMessage("Hi", "this is the body")
+	if strings.Contains(string(m.Headers()), "X-Auto-Response-Suppress:") {
+		t.Fatal("X-Auto-Response-Suppress written by default")
+	}
+
+	m.AutoResponseSuppress = []string{"OOF", "AutoReply", "DR"}
+	if !strings.Contains(string(m.Headers()), "X-Auto-Response-Suppress: OOF, AutoReply, DR\r\n") {
+		t.Fatalf("missing X-Auto-Response-Suppress:\n%s", m.Headers())
+	}
+}
+
+func TestDateLocation(t *testing.T) {
+	m := NewMessage("Hi", "this is the body")
+	m.Location = time.FixedZone("HQ", -5*3600)
+
+	msg, err := mail.ReadMessage(bytes.NewReader(m.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(msg.Header.Get("Date"), " -0500") {
+		t.Fatalf("unexpected Date %q", msg.Header.Get("Date"))
+	}
+	date, err := msg.Header.Date()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, offset := date.Zone(); offset != -5*3600 {
+		t.Fatalf("unexpected offset %d", offset)
+	}
+
+	m.Location = time.UTC
+	if h := string(m.Headers()); !strings.Contains(h, " +0000\r\n") {
+		t.Fatalf("unexpected Date in UTC:\n%s", h)
+	}
+}
+
+func TestComments(t *testing.T) {
+	m := NewMessage("Hi", "body")
+	if strings.Contains(string(m.Headers()), "Comments:") {
+		t.Fatal("Comments written by default")
+	}
+
+	m.Comments = "Approved by ops"
+	if !strings.Contains(string(m.Headers()), "Subject: Hi\r\nComments: Approved by ops\r\n") {
+		t.Fatalf("missing Comments:\n%s", m.Headers())
+	}
+	m.Comments = "Approuvé"
+	if !strings.Contains(string(m.Headers()), "Comments: =?utf-8?") {
+		t.Fatalf("Comments not encoded:\n%s", m.Headers())
+	}
+}
+
+func TestSetJSONHeader(t *testing.T) {
+	api := map[string]interface{}{"category": []string{"newsletter", "café"}}
+	var to []string
+	for i := 0; i < 200; i++ {
+		to = append(to, fmt.Sprintf("user%d@example.com", i))
+	}
+	api["to"] = to
+	data, _ := json.Marshal(api)
+
+	m := NewMessage("Hi", "body")
+	if err := m.SetJSONHeader("X-SMTPAPI", data); err != nil {
+		t.Fatal(err)
+	}
+	m.ExtraHeaders = append(m.ExtraHeaders, Header{Name: "X-Entity-Ref-ID", Value: "42"})
+
+	h := string(m.Headers())
+	if len(h) < 4096 || !strings.Contains(h, "X-Entity-Ref-ID: 42\r\nMIME-Version: 1.0\r\n") {
+		t.Fatalf("unexpected headers:\n%s", h)
+	}
+	for _, l := range strings.Split(h, "\r\n") {
+		if len(l) > 100 {
+			t.Fatalf("line not folded: %q", l)
+		}
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(h))
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := msg.Header.Get("X-SMTPAPI")
+	if strings.ContainsAny(value, "é\r\n") {
+		t.Fatalf("unexpected value %q", value)
+	}
+	var got map[string][]string
+	if err := json.Unmarshal([]byte(value), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["category"][1] != "café" || len(got["to"]) != 200 {
+		t.Fatalf("unexpected value %v", got)
+	}
+
+	for _, tt := range [][2]string{
+		{"X-SMTPAPI", `{"a": }`},
+		{"X SMTPAPI", `{}`},
+		{"X-SMTPAPI", `["` + strings.Repeat("a", 1000) + `"]`},
+	} {
+		if err := m.SetJSONHeader(tt[0], []byte(tt[1])); err == nil {
+			t.Fatalf("expected an error for %.20q", tt)
+		}
+	}
+}
+
+func TestAttachmentsOnly(t *testing.T) {
+	m := NewMessage("Hi", "")
+	m.Attachments["a.txt"] = &Attachment{Filename: "a.txt", Data: []byte("attachment")}
+	m.Attachments["b.txt"] = &Attachment{Filename: "b.txt", Data: []byte("another")}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(m.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, params, _ := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	r := multipart.NewReader(msg.Body, params["boundary"])
+	var names []string
+	for {
+		p, err := r.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, p.FileName())
+	}
+	if len(names) != 2 || names[0] == "" || names[1] == "" {
+		t.Fatalf("unexpected parts %q", names)
+	}
+	if err := m.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBodyFilename(t *testing.T) {
+	m := NewHTMLMessage("Hi", "<p>Hello</p>")
+	m.BodyFilename = "message.html"
+	if h := string(m.Headers()); !strings.Contains(h, "Content-Transfer-Encoding: 7bit\r\nContent-Disposition: inline; filename=\"message.html\"\r\n") {
+		t.Fatalf("missing disposition:\n%s", h)
+	}
+
+	m.AutoPlainText = true
+	m.Attachments["a.txt"] = &Attachment{Filename: "a.txt", Data: []byte("attachment")}
+	data := string(m.Bytes())
+	if n := strings.Count(data, "Content-Disposition: inline; filename=\"message.html\"\r\n"); n != 1 ||
+		!strings.Contains(data, "Content-Type: text/html; charset=utf-8\r\nContent-Transfer-Encoding: 7bit\r\nContent-Disposition: inline; filename=\"message.html\"\r\n\r\n<p>Hello</p>") {
+		t.Fatalf("unexpected disposition of the body part:\n%s", data)
+	}
+	if err := m.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOriginalMessageID(t *testing.T) {
+	m := NewMessage("Reminder", "body")
+	m.OriginalMessageID = "1@example.com"
+	h := string(m.Headers())
+	if !strings.Contains(h, "X-Original-Message-ID: <1@example.com>\r\nReferences: <1@example.com>\r\n") {
+		t.Fatalf("unexpected headers:\n%s", h)
+	}
+
+	m.References = []string{"<0@example.com>", "1@example.com"}
+	h = string(m.Headers())
+	if !strings.Contains(h, "References: <0@example.com> <1@example.com>\r\n") {
+		t.Fatalf("unexpected References:\n%s", h)
+	}
+}
+
+func TestSetInline(t *testing.T) {
+	m := NewMessage("Hi", "body")
+	m.Attachments["a.png"] = &Attachment{Filename: "a.png", Data: []byte("\x89PNG"), ContentType: "image/png"}
+
+	if err := m.SetInline("a.png", true); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(m.Bytes()), "Content-Disposition: inline; filename=\"a.png\"") {
+		t.Fatalf("attachment not inline:\n%s", m.Bytes())
+	}
+	if err := m.SetInline("a.png", false); err != nil || m.Attachments["a.png"].Inline {
+		t.Fatalf("attachment still inline: %v", err)
+	}
+	if err := m.SetInline("b.png", true); err == nil {
+		t.Fatal("expected an error for a missing attachment")
+	}
+}
+
+func TestKeywords(t *testing.T) {
+	m := NewMessage("Hi", "body")
+	if strings.Contains(string(m.Headers()), "Keywords:") {
+		t.Fatal("Keywords written by default")
+	}
+
+	m.Keywords = []string{"invoice", "2024", "reçu"}
+	h := string(m.Headers())
+	if !strings.Contains(h, "Keywords: invoice, 2024, =?utf-8?b?cmXDp3U=?=\r\n") {
+		t.Fatalf("unexpected Keywords:\n%s", h)
+	}
+	msg, _ := mail.ReadMessage(strings.NewReader(h))
+	if k, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Keywords")); k != "invoice, 2024, reçu" {
+		t.Fatalf("unexpected decoded Keywords %q", k)
+	}
+}
+
+func TestExpires(t *testing.T) {
+	m := NewMessage("Hi", "body")
+	if strings.Contains(string(m.Headers()), "Expires:") {
+		t.Fatal("Expires written by default")
+	}
+
+	m.Location = time.UTC
+	m.Expires = time.Date(2024, 3, 1, 18, 30, 0, 0, time.FixedZone("CET", 3600))
+	want := "Expires: Fri, 01 Mar 2024 17:30:00 +0000\r\nExpiry-Date: Fri, 01 Mar 2024 17:30:00 +0000\r\n"
+	h := string(m.Headers())
+	if !strings.Contains(h, want) {
+		t.Fatalf("unexpected headers:\n%s", h)
+	}
+	msg, _ := mail.ReadMessage(strings.NewReader(h))
+	if d, err := mail.ParseDate(msg.Header.Get("Expires")); err != nil || !d.Equal(m.Expires) {
+		t.Fatalf("invalid date %v: %v", d, err)
+	}
+}
+
+func TestDeterministicBytes(t *testing.T) {
+	defer func(r io.Reader, now func() time.Time) { randReader, nowFunc = r, now }(randReader, nowFunc)
+	nowFunc = func() time.Time { return time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC) }
+
+	write := func() []byte {
+		randReader = mrand.New(mrand.NewSource(1))
+		m := NewHTMLMessage("Hi", "<p>Hello</p>")
+		m.Location = time.UTC
+		m.AutoPlainText = true
+		m.Attachments["a.txt"] = &Attachment{Filename: "a.txt", Data: []byte("attachment")}
+		return m.Bytes()
+	}
+	a, b := write(), write()
+	if !bytes.Equal(a, b) {
+		t.Fatalf("different messages:\n%s\n%s", a, b)
+	}
+	if !bytes.Contains(a, []byte("Date: Fri, 01 Mar 2024 12:00:00 +0000\r\n")) {
+		t.Fatalf("unexpected Date:\n%s", a)
+	}
+}
+
+func TestPartHeaderOrder(t *testing.T) {
+	m := NewMessage("Hi", `<img src="cid:logo">`)
+	m.BodyContentType = "text/html"
+	m.AutoPlainText = true
+	m.Attachments["logo.png"] = &Attachment{
+		Filename:        "logo.png",
+		ContentType:     "image/png",
+		Data:            []byte("png"),
+		Inline:          true,
+		ContentID:       "logo",
+		ContentLocation: "images/logo.png",
+		Description:     "Logo",
+	}
+	m.Attachments["a.pdf"] = &Attachment{Filename: "a.pdf", Data: []byte("pdf"), Description: "Report"}
+
+	var names []string
+	for _, line := range strings.Split(string(m.Bytes()), "\r\n") {
+		if strings.HasPrefix(line, "Content-") {
+			names = append(names, line[:strings.Index(line, ":")])
+		}
+	}
+	want := []string{
+		"Content-Type",
+		"Content-Type",
+		"Content-Type",
+		"Content-Type", "Content-Transfer-Encoding",
+		"Content-Type", "Content-Transfer-Encoding",
+		"Content-Type", "Content-Transfer-Encoding", "Content-Disposition", "Content-ID", "Content-Location", "Content-Description",
+		"Content-Type", "Content-Transfer-Encoding", "Content-Disposition", "Content-Description",
+	}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Fatalf("unexpected part headers order:\n%s", strings.Join(names, "\n"))
+	}
+}
+
+func TestAttachmentOrder(t *testing.T) {
+	names := []string{"cover.pdf", "b.txt", "a.txt", "z.txt", "c.txt"}
+	order := func(m *Message) string {
+		var got []string
+		for _, line := range strings.Split(string(m.Bytes()), "\r\n") {
+			if strings.HasPrefix(line, "Content-Disposition: attachment; filename=") {
+				got = append(got, strings.Trim(line[len("Content-Disposition: attachment; filename="):], `"`))
+			}
+		}
+		return strings.Join(got, ",")
+	}
+
+	for i := 0; i < 20; i++ {
+		m := NewMessage("Hi", "body")
+		fsys := fstest.MapFS{}
+		for _, name := range names {
+			fsys[name] = &fstest.MapFile{Data: []byte(name)}
+		}
+		for _, name := range names {
+			if err := m.AttachFS(fsys, name, false); err != nil {
+				t.Fatal(err)
+			}
+		}
+		m.Attachments["d.txt"] = &Attachment{Filename: "d.txt", Data: []byte("d")}
+		if got := order(m); got != "cover.pdf,b.txt,a.txt,z.txt,c.txt,d.txt" {
+			t.Fatalf("unexpected order %s", got)
+		}
+
+		m.SortAttachments(func(a, b *Attachment) bool { return a.Filename < b.Filename })
+		if got := order(m.Clone()); got != "a.txt,b.txt,c.txt,cover.pdf,d.txt,z.txt" {
+			t.Fatalf("unexpected sorted order %s", got)
+		}
+	}
+}
+
+func TestReadReceipt(t *testing.T) {
+	m := NewMessage("Hi", "body")
+	m.ReadReceiptOptions = []MDNOption{{Name: "signed-receipt-protocol", Values: []string{"pkcs7-signature"}}}
+	if h := string(m.Headers()); strings.Contains(h, "Disposition-Notification") {
+		t.Fatalf("Disposition-Notification headers without ReadReceiptTo:\n%s", h)
+	}
+
+	m.ReadReceiptTo = "alice@example.com"
+	m.ReadReceiptOptions = append(m.ReadReceiptOptions, MDNOption{Name: "signed-receipt-micalg", Required: true, Values: []string{"sha256", "sha1"}})
+	want := "\r\nDisposition-Notification-To: alice@example.com\r\n" +
+		"Disposition-Notification-Options: signed-receipt-protocol=optional, pkcs7-signature;\r\n" +
+		"\tsigned-receipt-micalg=required, sha256,sha1\r\n"
+	if h := string(m.Headers()); !strings.Contains(h, want) {
+		t.Fatalf("unexpected Disposition-Notification headers:\n%s", h)
+	}
+}
+
+func TestReportAbuse(t *testing.T) {
+	m := NewMessage("Hi", "body")
+	if strings.Contains(string(m.Headers()), "X-Report-Abuse:") {
+		t.Fatal("X-Report-Abuse written by default")
+	}
+
+	m.ReportAbuse = "Please report abuse here: https://example.com/abuse"
+	if !strings.Contains(string(m.Headers()), "\r\nX-Report-Abuse: Please report abuse here: https://example.com/abuse\r\n") {
+		t.Fatalf("missing X-Report-Abuse:\n%s", m.Headers())
+	}
+}
+
+func TestSensitivity(t *testing.T) {
+	m := NewMessage("Hi", "body")
+	m.From = "from@example.com"
+	m.To = []string{"to@example.com"}
+	if strings.Contains(string(m.Headers()), "Sensitivity:") {
+		t.Fatal("Sensitivity written by default")
+	}
+
+	for _, s := range []string{"Personal", "Private", "Company-Confidential"} {
+		m.Sensitivity = s
+		if err := m.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(m.Headers()), "\r\nSensitivity: "+s+"\r\n") {
+			t.Fatalf("missing Sensitivity:\n%s", m.Headers())
+		}
+	}
+	m.Sensitivity = "Secret"
+	if err := m.Validate(); err == nil {
+		t.Fatal("expected an error for an invalid sensitivity")
+	}
+}
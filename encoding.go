@@ -0,0 +1,92 @@
+package email
+
+import (
+	"bufio"
+	"encoding/base64"
+	"io"
+	"mime/quotedprintable"
+	"strings"
+)
+
+// encoding returns the Content-Transfer-Encoding of the text s:
+// BodyEncoding if set, otherwise 7bit for ASCII, 8bit for other text and
+// quoted-printable if it has lines too long for SMTP.
+func (m *Message) encoding(s string) string {
+	if m.BodyEncoding != "" {
+		return m.BodyEncoding
+	}
+	enc := "7bit"
+	line := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\n':
+			line = 0
+			continue
+		case c >= 0x80 || c == 0:
+			enc = "8bit"
+		}
+		if line++; line > 998 {
+			return "quoted-printable"
+		}
+	}
+	return enc
+}
+
+// bodyEncoding returns the Content-Transfer-Encoding of the body. A
+// BodyReader is 8bit unless BodyEncoding is set.
+func (m *Message) bodyEncoding() string {
+	if m.BodyReader != nil && m.BodyEncoding == "" {
+		return "8bit"
+	}
+	return m.encoding(m.transcode(m.Body))
+}
+
+// needs8BitMIME reports whether a text part of the message is 8bit.
+func (m *Message) needs8BitMIME() bool {
+	if m.bodyEncoding() == "8bit" {
+		return true
+	}
+	if m.alternative() && m.encoding(m.transcode(htmlToText(m.Body))) == "8bit" {
+		return true
+	}
+	for _, t := range m.Translations {
+		if m.encoding(m.transcode(t.Body)) == "8bit" {
+			return true
+		}
+	}
+	return false
+}
+
+// writeEncoded writes the text read from r with the encoding enc, ending
+// with exactly one line break, which is also the start of the next
+// boundary delimiter in a multipart part.
+func writeEncoded(buf *bufio.Writer, enc string, r io.Reader) error {
+	lw := &lastByteWriter{w: buf}
+	var w io.WriteCloser
+	switch strings.ToLower(enc) {
+	case "quoted-printable":
+		w = quotedprintable.NewWriter(lw)
+	case "base64":
+		w = base64.NewEncoder(base64.StdEncoding, &lineWriter{w: buf})
+	default:
+		w = nopCloser{lw}
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if lw.last != '\n' {
+		buf.WriteString("\r\n")
+	}
+	return nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,105 @@
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func TestBodyEncoding(t *testing.T) {
+	long := strings.Repeat("a", 1000)
+	for _, tt := range []struct {
+		body, encoding, want string
+	}{
+		{"plain ASCII", "", "7bit"},
+		{"Crème brûlée", "", "8bit"},
+		{long, "", "quoted-printable"},
+		{"Crème brûlée", "quoted-printable", "quoted-printable"},
+		{"Crème brûlée", "base64", "base64"},
+	} {
+		m := NewMessage("Hi", tt.body)
+		m.BodyEncoding = tt.encoding
+		msg, err := mail.ReadMessage(bytes.NewReader(m.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cte := msg.Header.Get("Content-Transfer-Encoding"); cte != tt.want {
+			t.Fatalf("Content-Transfer-Encoding of %.20q with %q: %s, want %s", tt.body, tt.encoding, cte, tt.want)
+		}
+		if err := m.SelfCheck(); err != nil {
+			t.Fatal(err)
+		}
+
+		data, _ := ioutil.ReadAll(msg.Body)
+		switch tt.want {
+		case "quoted-printable":
+			data, _ = ioutil.ReadAll(quotedprintable.NewReader(bytes.NewReader(data)))
+		case "base64":
+			data, _ = base64.StdEncoding.DecodeString(strings.Replace(string(data), "\r\n", "", -1))
+		}
+		if strings.TrimRight(string(data), "\r\n") != tt.body {
+			t.Fatalf("body %.20q with %q decoded as %.20q", tt.body, tt.encoding, data)
+		}
+	}
+}
+
+func TestBodyEncoding7Bit(t *testing.T) {
+	m := NewMessage("Hi", "plain ASCII\nwith short lines")
+	m.Attachments["a.txt"] = &Attachment{Filename: "a.txt", Data: []byte("a")}
+
+	want := "Content-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: 7bit\r\n"
+	if s := string(m.Bytes()); !strings.Contains(s, want) {
+		t.Fatalf("missing 7bit label of the text part:\n%s", s)
+	}
+}
+
+func TestClientQuotedPrintableWithout8BitMIME(t *testing.T) {
+	for _, ext := range []string{"8BITMIME", "PIPELINING"} {
+		s := newTestServer(t, ext)
+		m := NewMessage("Hi", "Crème brûlée")
+		m.From = "from@example.com"
+		m.To = []string{"to@example.com"}
+		c := NewClient(s.Addr(), nil, false)
+		if err := c.Send(m); err != nil {
+			t.Fatal(err)
+		}
+		c.Close()
+
+		want := "Content-Transfer-Encoding: 8bit\n\nCrème brûlée\n"
+		if ext != "8BITMIME" {
+			want = "Content-Transfer-Encoding: quoted-printable\n\nCr=C3=A8me br=C3=BBl=C3=A9e\n"
+		}
+		if msg := s.Messages()[0]; !strings.HasSuffix(msg, want) {
+			t.Fatalf("unexpected message with %s:\n%s", ext, msg)
+		}
+		if m.BodyEncoding != "" {
+			t.Fatal("message modified")
+		}
+	}
+}
+
+func TestClientSignedWithout8BitMIME(t *testing.T) {
+	s := newTestServer(t, "PIPELINING")
+	m := NewMessage("Hi", "Crème brûlée")
+	m.From = "from@example.com"
+	m.To = []string{"to@example.com"}
+	m.DKIMSignature = "v=1; a=rsa-sha256; d=example.com; s=sel; h=from:to:subject; bh=x; b=y"
+	c := NewClient(s.Addr(), nil, false)
+	defer c.Close()
+	if err := c.Send(m); err == nil || !strings.Contains(err.Error(), "8BITMIME") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	m.From = "Renée <from@exämple.com>"
+	m.Body = "plain ASCII"
+	if err := c.Send(m); err == nil || !strings.Contains(err.Error(), "SMTPUTF8") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(s.Messages()) != 0 {
+		t.Fatal("signed message rewritten and sent")
+	}
+}
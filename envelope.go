@@ -0,0 +1,56 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+)
+
+// AlignEnvelope changes the domain of EnvelopeFrom to the one of From,
+// keeping its local part, so the envelope and the header are aligned as
+// DMARC and Gmail expect. The relay must accept the new address as the
+// envelope sender and deliver its bounces. It does nothing if EnvelopeFrom
+// is not set, as From is used then.
+func (m *Message) AlignEnvelope() error {
+	if m.EnvelopeFrom == "" {
+		return nil
+	}
+	domain := addressDomain(m.From)
+	if domain == "" {
+		return errors.New("email: From without a domain")
+	}
+	env, err := mail.ParseAddress(m.EnvelopeFrom)
+	if err != nil {
+		return fmt.Errorf("email: invalid EnvelopeFrom %q: %v", m.EnvelopeFrom, err)
+	}
+	at := strings.LastIndex(env.Address, "@")
+	m.EnvelopeFrom = env.Address[:at+1] + domain
+	return nil
+}
+
+// EnvelopeAligned reports whether the domain of the envelope sender, From
+// or EnvelopeFrom, is the one of From or a subdomain of it or the other
+// way around, like the relaxed alignment of DMARC. It is a warning sign if
+// it is false, as receivers like Gmail show the message "via" the
+// envelope domain.
+func (m *Message) EnvelopeAligned() bool {
+	if m.EnvelopeFrom == "" {
+		return true
+	}
+	from, env := addressDomain(m.From), addressDomain(m.EnvelopeFrom)
+	if from == "" || env == "" {
+		return false
+	}
+	return from == env || strings.HasSuffix(from, "."+env) || strings.HasSuffix(env, "."+from)
+}
+
+// addressDomain returns the domain of the address addr in lower case, or
+// "" if addr is not a valid address.
+func addressDomain(addr string) string {
+	a, err := mail.ParseAddress(addr)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(a.Address[strings.LastIndex(a.Address, "@")+1:])
+}
@@ -0,0 +1,47 @@
+package email
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAlignEnvelope(t *testing.T) {
+	m := NewMessage("Hi", "this is the body")
+	m.From = "Alice <alice@example.com>"
+	m.To = []string{"to@example.net"}
+	if !m.EnvelopeAligned() {
+		t.Fatal("From is always aligned with itself")
+	}
+
+	for _, env := range []string{"bounces@example.com", "bounces@mail.example.com", "bounces@EXAMPLE.com"} {
+		m.EnvelopeFrom = env
+		if !m.EnvelopeAligned() {
+			t.Fatalf("%s is aligned", env)
+		}
+	}
+	m.EnvelopeFrom = "bounces+alice=example.com@relay.net"
+	if m.EnvelopeAligned() {
+		t.Fatal("relay.net is not aligned")
+	}
+	if err := m.AlignEnvelope(); err != nil {
+		t.Fatal(err)
+	}
+	if m.EnvelopeFrom != "bounces+alice=example.com@example.com" || !m.EnvelopeAligned() {
+		t.Fatalf("unexpected envelope after aligning: %s", m.EnvelopeFrom)
+	}
+
+	s := newTestServer(t)
+	c := NewClient(s.Addr(), nil, false)
+	defer c.Close()
+	if err := c.Send(m); err != nil {
+		t.Fatal(err)
+	}
+	if cmds := strings.Join(s.Commands(), "\n"); !strings.Contains(cmds, "MAIL FROM:<bounces+alice=example.com@example.com>") {
+		t.Fatalf("EnvelopeFrom not used:\n%s", cmds)
+	}
+
+	m.From = "undisclosed"
+	if err := m.AlignEnvelope(); err == nil {
+		t.Fatal("expected an error for a From without a domain")
+	}
+}
@@ -0,0 +1,97 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+	"net/textproto"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IsGreylisted reports whether err is a temporary rejection by a server
+// doing greylisting. The message is expected to be sent again after a
+// delay, see RetryAfter.
+func IsGreylisted(err error) bool {
+	var e *textproto.Error
+	if !errors.As(err, &e) || e.Code/100 != 4 {
+		return false
+	}
+	if e.Code == 451 && strings.HasPrefix(e.Msg, "4.7.1") {
+		return true
+	}
+	msg := strings.ToLower(e.Msg)
+	return strings.Contains(msg, "greylist") || strings.Contains(msg, "graylist")
+}
+
+// IsPermanent reports whether err is a permanent rejection by a server,
+// with a 5xx code. Sending the same message again is expected to fail.
+func IsPermanent(err error) bool {
+	var e *textproto.Error
+	return errors.As(err, &e) && e.Code/100 == 5
+}
+
+var retryAfterRe = regexp.MustCompile(`(?i)\b(?:in|after)\s+(\d+)\s*(seconds?|secs?|s|minutes?|mins?|m|hours?|h)\b`)
+
+// RetryAfter returns the delay before retrying suggested by the text of a
+// temporary rejection, like "try again in 5 minutes". ok is false if err
+// is not a temporary rejection or does not suggest a delay.
+func RetryAfter(err error) (d time.Duration, ok bool) {
+	var e *textproto.Error
+	if !errors.As(err, &e) || e.Code/100 != 4 {
+		return 0, false
+	}
+	match := retryAfterRe.FindStringSubmatch(e.Msg)
+	if match == nil {
+		return 0, false
+	}
+	n, err := strconv.Atoi(match[1])
+	if err != nil {
+		return 0, false
+	}
+	switch strings.ToLower(match[2])[0] {
+	case 'h':
+		d = time.Hour
+	case 'm':
+		d = time.Minute
+	default:
+		d = time.Second
+	}
+	return time.Duration(n) * d, true
+}
+
+// EnhancedStatus is an enhanced status code (RFC 3463), like 4.4.5: the
+// class (2 success, 4 temporary or 5 permanent failure), the subject and
+// the detail.
+type EnhancedStatus struct {
+	Class, Subject, Detail int
+}
+
+func (s EnhancedStatus) String() string {
+	return fmt.Sprintf("%d.%d.%d", s.Class, s.Subject, s.Detail)
+}
+
+var enhancedStatusRe = regexp.MustCompile(`^([245])\.(\d{1,3})\.(\d{1,3})\b`)
+
+// ParseEnhancedStatus returns the enhanced status code at the start of the
+// text of a rejection by a server, like "4.4.5" in "451 4.4.5 Insufficient
+// system storage". ok is false if err is not a rejection or the text does
+// not start with a status of the same class as the reply code.
+func ParseEnhancedStatus(err error) (s EnhancedStatus, ok bool) {
+	var e *textproto.Error
+	if !errors.As(err, &e) {
+		return s, false
+	}
+	match := enhancedStatusRe.FindStringSubmatch(e.Msg)
+	if match == nil {
+		return s, false
+	}
+	s.Class, _ = strconv.Atoi(match[1])
+	s.Subject, _ = strconv.Atoi(match[2])
+	s.Detail, _ = strconv.Atoi(match[3])
+	if s.Class != e.Code/100 {
+		return EnhancedStatus{}, false
+	}
+	return s, true
+}
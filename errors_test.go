@@ -0,0 +1,71 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+	"net/textproto"
+	"testing"
+	"time"
+)
+
+func TestIsGreylisted(t *testing.T) {
+	tests := []struct {
+		err        error
+		greylisted bool
+		retry      time.Duration
+	}{
+		{&textproto.Error{Code: 451, Msg: "4.7.1 Please try again later"}, true, 0},
+		{&textproto.Error{Code: 450, Msg: "4.2.0 <to@example.com>: Recipient address rejected: Greylisted, see http://postgrey.schweikert.ch/"}, true, 0},
+		{&textproto.Error{Code: 451, Msg: "Greylisting in action, please come back in 5 minutes"}, true, 5 * time.Minute},
+		{&textproto.Error{Code: 421, Msg: "4.7.0 Try again after 300s"}, false, 300 * time.Second},
+		{&textproto.Error{Code: 452, Msg: "4.2.2 Mailbox full"}, false, 0},
+		{&textproto.Error{Code: 550, Msg: "5.7.1 Greylisted forever"}, false, 0},
+		{fmt.Errorf("sending: %w", &textproto.Error{Code: 451, Msg: "4.7.1 retry in 1 hour"}), true, time.Hour},
+		{errors.New("EOF"), false, 0},
+	}
+
+	for _, tt := range tests {
+		if got := IsGreylisted(tt.err); got != tt.greylisted {
+			t.Errorf("IsGreylisted(%v) = %v", tt.err, got)
+		}
+		d, ok := RetryAfter(tt.err)
+		if ok != (tt.retry != 0) || d != tt.retry {
+			t.Errorf("RetryAfter(%v) = %v, %v", tt.err, d, ok)
+		}
+	}
+}
+
+func TestParseEnhancedStatus(t *testing.T) {
+	tests := []struct {
+		err    error
+		status string
+		retry  time.Duration
+	}{
+		{&textproto.Error{Code: 451, Msg: "4.4.5 Insufficient system storage, try again in 60 seconds"}, "4.4.5", time.Minute},
+		{&textproto.Error{Code: 550, Msg: "5.1.1 The email account that you tried to reach does not exist. Please try\n5.1.1 double-checking the recipient's email address for typos or\n5.1.1 unnecessary spaces. https://support.google.com/mail/?p=NoSuchUser"}, "5.1.1", 0},
+		{&textproto.Error{Code: 550, Msg: "5.7.708 Service unavailable. Access denied, traffic not accepted from this IP."}, "5.7.708", 0},
+		{&textproto.Error{Code: 421, Msg: "4.7.0 [TSS04] Messages from 192.0.2.1 temporarily deferred due to unexpected volume or user complaints"}, "4.7.0", 0},
+		{&textproto.Error{Code: 452, Msg: "4.5.3 Too many recipients, retry after 10 minutes"}, "4.5.3", 10 * time.Minute},
+		{fmt.Errorf("sending: %w", &textproto.Error{Code: 554, Msg: "5.7.1 Message rejected as spam"}), "5.7.1", 0},
+		{&textproto.Error{Code: 554, Msg: "Transaction failed"}, "", 0},
+		{&textproto.Error{Code: 550, Msg: "4.1.1 Mailbox unavailable"}, "", 0},
+		{&textproto.Error{Code: 451, Msg: "4.4.5a Local error"}, "", 0},
+		{errors.New("EOF"), "", 0},
+	}
+
+	for _, tt := range tests {
+		s, ok := ParseEnhancedStatus(tt.err)
+		if ok != (tt.status != "") || (ok && s.String() != tt.status) {
+			t.Errorf("ParseEnhancedStatus(%v) = %v, %v", tt.err, s, ok)
+		}
+		d, ok := RetryAfter(tt.err)
+		if ok != (tt.retry != 0) || d != tt.retry {
+			t.Errorf("RetryAfter(%v) = %v, %v", tt.err, d, ok)
+		}
+	}
+
+	s, _ := ParseEnhancedStatus(&textproto.Error{Code: 550, Msg: "5.7.708 Access denied"})
+	if s.Class != 5 || s.Subject != 7 || s.Detail != 708 {
+		t.Fatalf("unexpected status %+v", s)
+	}
+}
@@ -0,0 +1,366 @@
+package email
+
+import (
+	"fmt"
+	"html"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var imgSrcRe = regexp.MustCompile(`(?i)<img\s[^>]*?\bsrc\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+
+var htmlTagRe = regexp.MustCompile(`(?i)</?(?:html|head|body|p|div|span|br|table|tr|td|ul|ol|li|h[1-6]|b|i|strong|em|img|a)(?:\s[^<>]*)?/?>`)
+
+// looksLikeHTML reports whether s has HTML markup: a doctype or at least
+// two common HTML tags, so that text with angle brackets, like an address
+// or a comparison, is not taken for HTML.
+func looksLikeHTML(s string) bool {
+	return strings.Contains(strings.ToLower(s), "<!doctype html") || len(htmlTagRe.FindAllStringIndex(s, 2)) == 2
+}
+
+// InlineImages attaches the local images referenced by the <img> tags of
+// the HTML body as inline parts and replaces their src with the cid: URL
+// of the part. The paths are resolved from dir and must not be absolute
+// or escape it with "..". Remote images, including protocol-relative ones,
+// and data: or cid: URLs are left untouched. The attachments are keyed by
+// the file name, with a numeric suffix if it is already used. The images
+// are read each time the message is written instead of being kept in
+// memory. If any image can not be found the message is not modified.
+func (m *Message) InlineImages(dir string) error {
+	type image struct {
+		start, end int
+		name, file string
+	}
+
+	// the images are resolved before the message is modified, so an error
+	// does not leave some of them attached
+	var images []image
+	for _, match := range imgSrcRe.FindAllStringSubmatchIndex(m.Body, -1) {
+		// the src value is in one of the three alternative groups
+		start, end := match[2], match[3]
+		for i := 4; start < 0; i += 2 {
+			start, end = match[i], match[i+1]
+		}
+
+		src := html.UnescapeString(m.Body[start:end])
+		u, err := url.Parse(src)
+		if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" {
+			continue
+		}
+
+		name := path.Clean(u.Path)
+		if !fs.ValidPath(name) {
+			return fmt.Errorf("email: invalid image path %q", src)
+		}
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if _, err := os.Stat(file); err != nil {
+			return err
+		}
+		images = append(images, image{start, end, name, file})
+	}
+
+	cids := make(map[string]string)
+	var b strings.Builder
+	last := 0
+	for _, img := range images {
+		cid, ok := cids[img.file]
+		if !ok {
+			filename := m.unusedAttachmentName(path.Base(img.name))
+			cid = randomBoundary() + "@" + cidName(filename)
+			m.setAttachment(filename, &Attachment{
+				Filename:    filename,
+				Inline:      true,
+				ContentType: contentType(filename),
+				ContentID:   cid,
+				Source:      FileSource(img.file),
+			})
+			cids[img.file] = cid
+		}
+
+		b.WriteString(m.Body[last:img.start])
+		b.WriteString("cid:" + cid)
+		last = img.end
+	}
+
+	b.WriteString(m.Body[last:])
+	m.Body = b.String()
+	return nil
+}
+
+// cidName returns filename with the characters that are not allowed in a
+// Content-ID, or need escaping in a cid: URL, replaced with "_".
+func cidName(filename string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9', r == '.', r == '-':
+			return r
+		}
+		return '_'
+	}, filename)
+}
+
+// blockTags are the HTML elements that start a new line in the text version.
+var blockTags = map[string]bool{
+	"p": true, "div": true, "tr": true, "li": true, "ul": true, "ol": true,
+	"table": true, "blockquote": true, "pre": true, "hr": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+}
+
+// voidTags are the HTML elements without content or closing tag.
+var voidTags = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true,
+	"hr": true, "img": true, "input": true, "link": true, "meta": true,
+	"source": true, "track": true, "wbr": true,
+}
+
+// htmlToText returns a plain text version of the HTML document s. It is not
+// a full HTML parser: scripts, styles and hidden elements, like preheaders
+// with display:none, are dropped, <br> and block elements are converted to
+// line breaks and links are written as "text (url)", unless their only
+// content is a tracking pixel.
+func htmlToText(s string) string {
+	var b strings.Builder
+	var links []string
+	var linkStart []int
+	var linkImage []bool
+
+	for len(s) > 0 {
+		i := strings.IndexByte(s, '<')
+		if i < 0 {
+			writeHTMLText(&b, s)
+			break
+		}
+		writeHTMLText(&b, s[:i])
+		s = s[i:]
+
+		if strings.HasPrefix(s, "<!--") {
+			j := strings.Index(s, "-->")
+			if j < 0 {
+				break
+			}
+			s = s[j+3:]
+			continue
+		}
+
+		j := strings.IndexByte(s, '>')
+		if j < 0 {
+			break
+		}
+		name, attrs, closing := parseTag(s[1:j])
+		s = s[j+1:]
+
+		switch {
+		case !closing && !voidTags[name] && hiddenElement(attrs):
+			s = skipElement(s, name)
+		case name == "img" && len(linkImage) > 0 && !hiddenElement(attrs) && !trackingPixel(attrs):
+			linkImage[len(linkImage)-1] = true
+		case name == "script" || name == "style" || name == "head":
+			if !closing {
+				k := strings.Index(strings.ToLower(s), "</"+name)
+				if k < 0 {
+					s = ""
+				} else {
+					s = s[k:]
+				}
+			}
+		case name == "br":
+			b.WriteString("\n")
+		case blockTags[name]:
+			b.WriteString("\n\n")
+		case name == "a" && !closing:
+			links = append(links, attrs["href"])
+			linkStart = append(linkStart, b.Len())
+			linkImage = append(linkImage, false)
+		case name == "a" && closing && len(links) > 0:
+			href, start, image := links[len(links)-1], linkStart[len(linkStart)-1], linkImage[len(linkImage)-1]
+			links, linkStart, linkImage = links[:len(links)-1], linkStart[:len(linkStart)-1], linkImage[:len(linkImage)-1]
+			text := strings.TrimSpace(b.String()[start:])
+			if text == "" && !image {
+				// an empty link or one around a tracking pixel
+				continue
+			}
+			if href != "" && href != text && !strings.HasPrefix(href, "#") {
+				b.WriteString(" (" + href + ")")
+			}
+		}
+	}
+
+	return cleanText(b.String())
+}
+
+// hiddenElement reports whether the element with attrs is not displayed,
+// with the hidden attribute or a display:none or visibility:hidden style.
+func hiddenElement(attrs map[string]string) bool {
+	if _, ok := attrs["hidden"]; ok {
+		return true
+	}
+	style := styleProperties(attrs["style"])
+	return style["display"] == "none" || style["visibility"] == "hidden"
+}
+
+// trackingPixel reports whether the image with attrs is at most 1x1
+// pixels, as the images used to track the opening of messages.
+func trackingPixel(attrs map[string]string) bool {
+	style := styleProperties(attrs["style"])
+	small := func(attr, prop string) bool {
+		v := attrs[attr]
+		if p, ok := style[prop]; ok {
+			v = p
+		}
+		v = strings.TrimSuffix(v, "px")
+		return v == "0" || v == "1"
+	}
+	return small("width", "width") && small("height", "height")
+}
+
+// styleProperties returns the lower cased properties of the inline style
+// s, without spaces or !important.
+func styleProperties(s string) map[string]string {
+	props := make(map[string]string)
+	for _, decl := range strings.Split(s, ";") {
+		i := strings.IndexByte(decl, ':')
+		if i < 0 {
+			continue
+		}
+		value := strings.ToLower(strings.Join(strings.Fields(decl[i+1:]), ""))
+		props[strings.ToLower(strings.TrimSpace(decl[:i]))] = strings.TrimSuffix(value, "!important")
+	}
+	return props
+}
+
+// skipElement returns s, the HTML after the start tag of an element name,
+// after the end tag of that element, taking into account nested elements
+// with the same name.
+func skipElement(s, name string) string {
+	lower := strings.ToLower(s)
+	depth := 1
+	for i := 0; i < len(lower); {
+		j := strings.IndexByte(lower[i:], '<')
+		if j < 0 {
+			break
+		}
+		i += j + 1
+		closing := strings.HasPrefix(lower[i:], "/")
+		if closing {
+			i++
+		}
+		if !strings.HasPrefix(lower[i:], name) {
+			continue
+		}
+		end := i + len(name)
+		if end < len(lower) && !strings.ContainsRune(" \t\r\n/>", rune(lower[end])) {
+			continue
+		}
+		if closing {
+			if depth--; depth == 0 {
+				k := strings.IndexByte(s[end:], '>')
+				if k < 0 {
+					return ""
+				}
+				return s[end+k+1:]
+			}
+		} else {
+			depth++
+		}
+	}
+	return ""
+}
+
+// writeHTMLText writes the character data s collapsing the whitespace.
+func writeHTMLText(b *strings.Builder, s string) {
+	s = html.UnescapeString(s)
+	s = strings.Replace(s, " ", " ", -1)
+	space := false
+	for _, r := range s {
+		switch r {
+		case ' ', '\t', '\r', '\n', '\f':
+			space = true
+		default:
+			if space {
+				b.WriteByte(' ')
+				space = false
+			}
+			b.WriteRune(r)
+		}
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+}
+
+// cleanText trims the lines of s and collapses consecutive blank lines.
+func cleanText(s string) string {
+	lines := strings.Split(s, "\n")
+	out := make([]string, 0, len(lines))
+	blank := false
+	for _, l := range lines {
+		l = strings.Join(strings.Fields(l), " ")
+		if l == "" {
+			blank = len(out) > 0
+			continue
+		}
+		if blank {
+			out = append(out, "")
+			blank = false
+		}
+		out = append(out, l)
+	}
+	return strings.Join(out, "\n")
+}
+
+// parseTag returns the lower cased name and the attributes of the tag
+// whose contents between "<" and ">" are s.
+func parseTag(s string) (name string, attrs map[string]string, closing bool) {
+	s = strings.TrimSuffix(s, "/")
+	if strings.HasPrefix(s, "/") {
+		closing = true
+		s = s[1:]
+	}
+	i := strings.IndexAny(s, " \t\r\n")
+	if i < 0 {
+		return strings.ToLower(s), nil, closing
+	}
+	name, s = strings.ToLower(s[:i]), s[i:]
+
+	attrs = make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " \t\r\n")
+		if s == "" {
+			return name, attrs, closing
+		}
+		i := strings.IndexAny(s, "= \t\r\n")
+		if i < 0 {
+			attrs[strings.ToLower(s)] = ""
+			return name, attrs, closing
+		}
+		key := strings.ToLower(s[:i])
+		s = strings.TrimLeft(s[i:], " \t\r\n")
+		if !strings.HasPrefix(s, "=") {
+			attrs[key] = ""
+			continue
+		}
+		s = strings.TrimLeft(s[1:], " \t\r\n")
+		var value string
+		if len(s) > 0 && (s[0] == '"' || s[0] == '\'') {
+			j := strings.IndexByte(s[1:], s[0])
+			if j < 0 {
+				value, s = s[1:], ""
+			} else {
+				value, s = s[1:j+1], s[j+2:]
+			}
+		} else {
+			j := strings.IndexAny(s, " \t\r\n")
+			if j < 0 {
+				value, s = s, ""
+			} else {
+				value, s = s[:j], s[j:]
+			}
+		}
+		attrs[key] = html.UnescapeString(value)
+	}
+}
@@ -0,0 +1,178 @@
+package email
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHTMLToText(t *testing.T) {
+	tests := []struct {
+		html string
+		text string
+	}{
+		{"<p>Hello <b>world</b></p>", "Hello world"},
+		{"<p>One</p><p>Two</p>", "One\n\nTwo"},
+		{"Line 1<br>Line 2<br/>Line 3", "Line 1\nLine 2\nLine 3"},
+		{"Fish &amp; chips &lt;3&nbsp;today", "Fish & chips <3 today"},
+		{`See <a href="https://example.com/x?a=1&amp;b=2">the docs</a>.`, "See the docs (https://example.com/x?a=1&b=2)."},
+		{`<a href="https://example.com">https://example.com</a>`, "https://example.com"},
+		{"<html><head><title>T</title><style>p { color: red }</style></head>" +
+			"<body><script>alert('x')</script><p>Body</p></body></html>", "Body"},
+		{"<div>\n   spaced \n\n  out   </div><!-- comment -->", "spaced out"},
+		{`<a href="https://example.com/shop"><img src="button.png"></a>`, "(https://example.com/shop)"},
+		{`<p>Hi</p><p hidden>secret</p><p STYLE="Display: None !important">preview</p>`, "Hi"},
+		{`<div style="display:none"><div>nested</div> hidden</div><div>shown</div>`, "shown"},
+	}
+
+	for _, tt := range tests {
+		if got := htmlToText(tt.html); got != tt.text {
+			t.Errorf("htmlToText(%q) = %q, want %q", tt.html, got, tt.text)
+		}
+	}
+}
+
+func TestHTMLToTextMarketing(t *testing.T) {
+	const body = `<!DOCTYPE html>
+<html><head><style>.preheader { display: none }</style></head>
+<body>
+<div style="display:none;font-size:1px;max-height:0;overflow:hidden;mso-hide:all">
+  Save 20% on everything this weekend only&nbsp;&zwnj;&nbsp;&zwnj;
+</div>
+<table><tr><td>
+  <h1>Spring sale</h1>
+  <p>Everything is 20% off until Sunday.</p>
+  <p><a href="https://shop.example.com/sale">Shop now</a></p>
+  <span style="visibility: hidden">unsubscribe-token-1234</span>
+</td></tr></table>
+<script>track()</script>
+<a href="https://t.example.com/open?id=1"><img src="https://t.example.com/o.gif" width="1" height="1" alt=""></a>
+<img src="https://t.example.com/p.gif" style="width:1px;height:1px;border:0" alt="">
+<img src="https://t.example.com/q.gif" style="display:none">
+</body></html>`
+
+	want := "Spring sale\n\nEverything is 20% off until Sunday.\n\nShop now (https://shop.example.com/sale)"
+	if got := htmlToText(body); got != want {
+		t.Fatalf("htmlToText = %q, want %q", got, want)
+	}
+}
+
+func TestAutoPlainText(t *testing.T) {
+	m := NewHTMLMessage("Hi", "<p>Hello <b>world</b></p>")
+	m.AutoPlainText = true
+
+	data := string(m.Bytes())
+	if !strings.Contains(data, "Content-Type: multipart/alternative; boundary=") {
+		t.Fatalf("missing multipart/alternative:\n%s", data)
+	}
+	plain := strings.Index(data, "Content-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: 7bit\r\n\r\nHello world\r\n")
+	html := strings.Index(data, "Content-Type: text/html; charset=utf-8\r\nContent-Transfer-Encoding: 7bit\r\n\r\n<p>Hello <b>world</b></p>")
+	if plain < 0 || html < plain {
+		t.Fatalf("unexpected alternative parts:\n%s", data)
+	}
+}
+
+func TestInlineImages(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "img"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"logo.png", "img/photo.jpg", "my logo>.png"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := NewHTMLMessage("Hi", `<img src="logo.png"><img alt='x' src='img/photo.jpg'>`+
+		`<img src="https://example.com/a.png"><img src="cid:existing@example.com"><img src=logo.png>`+
+		`<img src="//cdn.example.com/a.png"><img src="logo.png?v=2"><img src="my%20logo&gt;.png">`)
+	if err := m.InlineImages(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m.Attachments) != 3 {
+		t.Fatalf("expected 3 inline images, got %d", len(m.Attachments))
+	}
+	for _, a := range m.Attachments {
+		if !a.Inline || a.ContentID == "" {
+			t.Fatalf("image %s not inline", a.Filename)
+		}
+		if strings.Count(m.Body, "cid:"+a.ContentID) != map[string]int{"logo.png": 3, "photo.jpg": 1, "my logo>.png": 1}[a.Filename] {
+			t.Fatalf("src of %s not replaced: %s", a.Filename, m.Body)
+		}
+		if strings.ContainsAny(a.ContentID, " <>") {
+			t.Fatalf("invalid Content-ID %q", a.ContentID)
+		}
+	}
+	for _, src := range []string{`src="https://example.com/a.png"`, `src="cid:existing@example.com"`, `src="//cdn.example.com/a.png"`} {
+		if !strings.Contains(m.Body, src) {
+			t.Fatalf("%s modified: %s", src, m.Body)
+		}
+	}
+	if !strings.Contains(string(m.Bytes()), "Content-Type: multipart/related; boundary=") {
+		t.Fatal("inline images not in a multipart/related part")
+	}
+
+	if err := m.SetInline("logo.png", false); err != nil {
+		t.Fatal(err)
+	}
+
+	body := `<img src="logo.png"><img src="missing.png">`
+	m = NewHTMLMessage("Hi", body)
+	if err := m.InlineImages(dir); err == nil {
+		t.Fatal("expected an error for a missing image")
+	}
+	if len(m.Attachments) != 0 || m.Body != body {
+		t.Fatalf("message modified on error: %v %s", m.attachmentNames(), m.Body)
+	}
+
+	secret := filepath.Join(filepath.Dir(dir), "secret.png")
+	if err := ioutil.WriteFile(secret, []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(secret)
+	for _, src := range []string{secret, "../secret.png", "img/../../secret.png"} {
+		m = NewHTMLMessage("Hi", `<img src="`+src+`">`)
+		if err := m.InlineImages(dir); err == nil || !strings.Contains(err.Error(), "invalid image path") {
+			t.Fatalf("expected an error for %s", src)
+		}
+	}
+
+	if err := os.Mkdir(filepath.Join(dir, "other"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "other", "logo.png"), []byte("other"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m = NewHTMLMessage("Hi", `<img src="logo.png"><img src="./other/logo.png">`)
+	if err := m.InlineImages(dir); err != nil {
+		t.Fatal(err)
+	}
+	if m.Attachments["logo.png"] == nil || m.Attachments["logo-2.png"] == nil || m.Attachments["logo-2.png"].Filename != "logo-2.png" {
+		t.Fatalf("unexpected attachments %v", m.attachmentNames())
+	}
+}
+
+func TestStrictContentType(t *testing.T) {
+	for body, html := range map[string]bool{
+		"<p>Hello <b>Bob</b></p>":                            true,
+		"<!DOCTYPE html>":                                    true,
+		"Hello<br>\r\nBye<br/>":                              true,
+		"Write to <bob@example.com>, since 1 < 2 and 3 > 2.": false,
+		"Use <b> for bold text.":                             false,
+		"Vector<int> and Map<String, List<a>>":               false,
+	} {
+		m := NewMessage("Hi", body)
+		m.From = "from@example.com"
+		m.To = []string{"to@example.com"}
+		if err := m.Validate(); err != nil {
+			t.Fatalf("not strict: %v", err)
+		}
+		m.StrictContentType = true
+		if err := m.Validate(); (err != nil) != html {
+			t.Fatalf("Validate of %q: %v", body, err)
+		}
+	}
+}
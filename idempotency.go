@@ -0,0 +1,49 @@
+package email
+
+import (
+	"sync"
+	"time"
+)
+
+// IdempotencyStore records the idempotency keys of the messages sent, so
+// a Client can skip the messages submitted twice. Implementations must be
+// safe for concurrent use and can be backed by a shared database to work
+// across processes.
+type IdempotencyStore interface {
+	// Seen reports whether a message with key was sent.
+	Seen(key string) (bool, error)
+	// Add records that a message with key was sent.
+	Add(key string) error
+}
+
+type memoryStore struct {
+	ttl  time.Duration
+	mu   sync.Mutex
+	keys map[string]time.Time
+}
+
+// NewMemoryStore returns an IdempotencyStore that remembers the keys for
+// ttl in memory. It is not shared across processes and is lost on restart.
+func NewMemoryStore(ttl time.Duration) IdempotencyStore {
+	return &memoryStore{ttl: ttl, keys: make(map[string]time.Time)}
+}
+
+func (s *memoryStore) Seen(key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expires, ok := s.keys[key]
+	return ok && time.Now().Before(expires), nil
+}
+
+func (s *memoryStore) Add(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for k, expires := range s.keys {
+		if !now.Before(expires) {
+			delete(s.keys, k)
+		}
+	}
+	s.keys[key] = now.Add(s.ttl)
+	return nil
+}
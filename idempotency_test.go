@@ -0,0 +1,40 @@
+package email
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClientIdempotency(t *testing.T) {
+	s := newTestServer(t)
+
+	c := NewClient(s.Addr(), nil, false)
+	defer c.Close()
+	c.Idempotency = NewMemoryStore(time.Hour)
+
+	for _, key := range []string{"job-1", "job-1", "job-2", "", ""} {
+		m := NewMessage("Hi", "this is the body")
+		m.From = "from@example.com"
+		m.To = []string{"to@example.com"}
+		m.IdempotencyKey = key
+		if err := c.Send(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := len(s.Messages()); n != 4 {
+		t.Fatalf("expected 4 messages, got %d", n)
+	}
+}
+
+func TestMemoryStoreTTL(t *testing.T) {
+	store := NewMemoryStore(10 * time.Millisecond)
+	store.Add("key")
+	if seen, _ := store.Seen("key"); !seen {
+		t.Fatal("key not seen")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if seen, _ := store.Seen("key"); seen {
+		t.Fatal("key seen after its TTL")
+	}
+}
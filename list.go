@@ -0,0 +1,116 @@
+package email
+
+import (
+	"fmt"
+	"net/textproto"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// listHeaders are the mailing list headers of RFC 2369 and RFC 2919, in
+// the order they are written.
+var listHeaders = []string{
+	"List-Id",
+	"List-Help",
+	"List-Unsubscribe",
+	"List-Subscribe",
+	"List-Post",
+	"List-Owner",
+	"List-Archive",
+}
+
+var listIDRe = regexp.MustCompile(`^[A-Za-z0-9!#$%&'*+/=?^_{|}~-]+(\.[A-Za-z0-9!#$%&'*+/=?^_{|}~-]+)+$`)
+
+// atomsRe matches a phrase of atoms that can be written without quotes.
+var atomsRe = regexp.MustCompile(`^[A-Za-z0-9!#$%&'*+/=?^_{|}~-]+( [A-Za-z0-9!#$%&'*+/=?^_{|}~-]+)*$`)
+
+// SetListHeader sets the mailing list header name, like "List-Help" or
+// "List-Archive", to the given URIs written between angle brackets. The
+// URIs must be absolute, like mailto: or https: URIs; List-Post also
+// accepts "NO". For List-Id the arguments are the list id, like
+// "announce.example.com", and an optional description, quoted or encoded
+// as needed.
+func (m *Message) SetListHeader(name string, uris ...string) error {
+	name = textproto.CanonicalMIMEHeaderKey(name)
+	if !contains(listHeaders, name) {
+		return fmt.Errorf("email: unknown list header %s", name)
+	}
+	if len(uris) == 0 {
+		return fmt.Errorf("email: missing value of %s", name)
+	}
+
+	var value string
+	switch {
+	case name == "List-Id":
+		if len(uris) > 2 || !listIDRe.MatchString(uris[0]) {
+			return fmt.Errorf("email: invalid list id %q", uris[0])
+		}
+		value = "<" + uris[0] + ">"
+		if len(uris) == 2 {
+			if strings.ContainsAny(uris[1], "\r\n") {
+				return fmt.Errorf("email: invalid list description %q", uris[1])
+			}
+			value = m.phrase(uris[1]) + " " + value
+		}
+	case name == "List-Post" && len(uris) == 1 && uris[0] == "NO":
+		value = "NO"
+	default:
+		list := make([]string, len(uris))
+		for i, uri := range uris {
+			u, err := url.Parse(uri)
+			if err != nil || u.Scheme == "" || strings.ContainsAny(uri, "<> \t\r\n") {
+				return fmt.Errorf("email: invalid URI of %s: %q", name, uri)
+			}
+			list[i] = "<" + uri + ">"
+		}
+		value = strings.Join(list, ", ")
+	}
+
+	if m.ListHeaders == nil {
+		m.ListHeaders = make(map[string]string)
+	}
+	m.ListHeaders[name] = value
+	return nil
+}
+
+// phrase returns s as an RFC 5322 phrase: as is if it is made of atoms,
+// as a quoted string if it is other printable ASCII and as an RFC 2047
+// encoded word otherwise.
+func (m *Message) phrase(s string) string {
+	switch {
+	case atomsRe.MatchString(s):
+		return s
+	case isPrintableASCII(s):
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+	}
+	return m.encodeWord(s)
+}
+
+// sortedListHeaders returns the names of m.ListHeaders in the order they
+// are written.
+func (m *Message) sortedListHeaders() []string {
+	var names, others []string
+	for _, h := range listHeaders {
+		if _, ok := m.ListHeaders[h]; ok {
+			names = append(names, h)
+		}
+	}
+	for h := range m.ListHeaders {
+		if !contains(listHeaders, h) {
+			others = append(others, h)
+		}
+	}
+	sort.Strings(others)
+	return append(names, others...)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
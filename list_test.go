@@ -0,0 +1,56 @@
+package email
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSetListHeader(t *testing.T) {
+	m := NewMessage("Hi", "this is the body")
+	for _, h := range [][]string{
+		{"List-Archive", "https://example.com/archive"},
+		{"list-help", "mailto:help@example.com?subject=help", "https://example.com/help"},
+		{"List-Id", "announce.example.com", "Announcements"},
+		{"List-Post", "NO"},
+		{"List-Owner", "mailto:owner@example.com"},
+	} {
+		if err := m.SetListHeader(h[0], h[1:]...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := "List-Id: Announcements <announce.example.com>\r\n" +
+		"List-Help: <mailto:help@example.com?subject=help>, <https://example.com/help>\r\n" +
+		"List-Post: NO\r\n" +
+		"List-Owner: <mailto:owner@example.com>\r\n" +
+		"List-Archive: <https://example.com/archive>\r\n"
+	if h := string(m.Headers()); !strings.Contains(h, want) {
+		t.Fatalf("unexpected list headers:\n%s", h)
+	}
+
+	for _, h := range [][]string{
+		{"List-Foo", "https://example.com"},
+		{"List-Help", "example.com/help"},
+		{"List-Help", "https://example.com/a b"},
+		{"List-Help"},
+		{"List-Id", "not a list id"},
+		{"List-Id", "announce.example.com", "News\r\nBcc: victim@example.com"},
+	} {
+		if err := m.SetListHeader(h[0], h[1:]...); err == nil {
+			t.Fatalf("expected an error for %q", h)
+		}
+	}
+
+	for desc, want := range map[string]string{
+		"Announcements, news": `"Announcements, news" <announce.example.com>`,
+		`The "best" <list>`:   `"The \"best\" <list>" <announce.example.com>`,
+		"Crème brûlée":        "=?utf-8?b?Q3LDqG1lIGJyw7tsw6ll?= <announce.example.com>",
+	} {
+		if err := m.SetListHeader("List-Id", "announce.example.com", desc); err != nil {
+			t.Fatal(err)
+		}
+		if got := m.ListHeaders["List-Id"]; got != want {
+			t.Fatalf("List-Id of %q: got %q, want %q", desc, got, want)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package email
+
+import (
+	"fmt"
+	"net"
+	"net/textproto"
+	"strings"
+)
+
+// LMTPStatus is the delivery status of a recipient returned by an LMTP server.
+type LMTPStatus struct {
+	Recipient string
+	Code      int
+	Msg       string
+}
+
+// LMTPError is returned by SendLMTP when the message could not be delivered
+// to some of the recipients.
+type LMTPError []LMTPStatus
+
+func (e LMTPError) Error() string {
+	s := make([]string, len(e))
+	for i, st := range e {
+		s[i] = fmt.Sprintf("%s: %03d %s", st.Recipient, st.Code, st.Msg)
+	}
+	return "LMTP delivery failed for " + strings.Join(s, "; ")
+}
+
+// SendLMTP delivers m through the LMTP server connected to conn, like a
+// local mail store. Unlike SMTP, LMTP reports a status for each recipient
+// after the data is sent. SendLMTP returns the statuses of all the
+// recipients, in order, including the ones rejected by RCPT, which are
+// not sent the data; if any of them is a failure an LMTPError with the
+// failures is returned too. conn is closed when SendLMTP returns.
+func SendLMTP(conn net.Conn, m *Message) ([]LMTPStatus, error) {
+	tp := textproto.NewConn(conn)
+	defer tp.Close()
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+
+	if _, _, err := tp.ReadResponse(220); err != nil {
+		return nil, err
+	}
+	if _, _, err := cmd(tp, 250, "LHLO localhost"); err != nil {
+		return nil, err
+	}
+	// the addresses are sent as they are, as local servers accept UTF-8
+	from, _ := envelopeAddress(m.envelopeSender(), true)
+	if _, _, err := cmd(tp, 250, "MAIL FROM:<%s>", from); err != nil {
+		return nil, err
+	}
+
+	rcpts := m.Tolist()
+	statuses := make([]LMTPStatus, len(rcpts))
+	var accepted []int
+	for i, to := range rcpts {
+		addr, _ := envelopeAddress(to, true)
+		code, msg, err := cmd(tp, 25, "RCPT TO:<%s>", addr)
+		if err != nil {
+			if _, ok := err.(*textproto.Error); !ok {
+				return nil, err
+			}
+		} else {
+			accepted = append(accepted, i)
+		}
+		statuses[i] = LMTPStatus{Recipient: to, Code: code, Msg: msg}
+	}
+
+	if len(accepted) > 0 {
+		if _, _, err := cmd(tp, 354, "DATA"); err != nil {
+			return nil, err
+		}
+		w := tp.DotWriter()
+		if _, err := m.WriteTo(w); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+
+		// one reply for each accepted recipient
+		for _, i := range accepted {
+			code, msg, err := tp.ReadResponse(250)
+			if err != nil {
+				if _, ok := err.(*textproto.Error); !ok {
+					return nil, err
+				}
+			}
+			statuses[i].Code, statuses[i].Msg = code, msg
+		}
+	}
+
+	cmd(tp, 221, "QUIT")
+
+	var failed LMTPError
+	for _, st := range statuses {
+		if st.Code/100 != 2 {
+			failed = append(failed, st)
+		}
+	}
+	if len(failed) > 0 {
+		return statuses, failed
+	}
+	return statuses, nil
+}
@@ -0,0 +1,116 @@
+package email
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSendLMTP(t *testing.T) {
+	s := newTestServer(t)
+	s.lmtp = func(rcpt string) string {
+		if strings.Contains(rcpt, "full@") {
+			return "452 4.2.2 Mailbox full"
+		}
+		return "250 2.0.0 Saved"
+	}
+
+	m := NewMessage("Hi", "this is the body")
+	m.From = "from@example.com"
+	m.To = []string{"ok@example.com", "full@example.com"}
+
+	conn, err := net.Dial("tcp", s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses, err := SendLMTP(conn, m)
+
+	lerr, ok := err.(LMTPError)
+	if !ok {
+		t.Fatalf("expected an LMTPError, got %v", err)
+	}
+	if len(lerr) != 1 || lerr[0].Recipient != "full@example.com" || lerr[0].Code != 452 {
+		t.Fatalf("unexpected failures: %+v", lerr)
+	}
+	if len(statuses) != 2 || statuses[0].Recipient != "ok@example.com" || statuses[0].Code != 250 {
+		t.Fatalf("unexpected statuses: %+v", statuses)
+	}
+	if cmds := s.Commands(); cmds[0] != "LHLO localhost" {
+		t.Fatalf("expected LHLO, got %v", cmds)
+	}
+	if len(s.Messages()) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(s.Messages()))
+	}
+}
+
+func TestSendLMTPRejectedRcpt(t *testing.T) {
+	s := newTestServer(t)
+	s.reply = func(cmd string) string {
+		if strings.Contains(cmd, "unknown@") {
+			return "550 5.1.1 No such user"
+		}
+		return ""
+	}
+	s.lmtp = func(rcpt string) string { return "250 2.0.0 Saved" }
+
+	m := NewMessage("Hi", "this is the body")
+	m.From = "from@example.com"
+	m.To = []string{"unknown@example.com", "ok@example.com", "other@example.com"}
+
+	conn, err := net.Dial("tcp", s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses, err := SendLMTP(conn, m)
+
+	lerr, ok := err.(LMTPError)
+	if !ok {
+		t.Fatalf("expected an LMTPError, got %v", err)
+	}
+	if len(lerr) != 1 || lerr[0].Recipient != "unknown@example.com" || lerr[0].Code != 550 {
+		t.Fatalf("unexpected failures: %+v", lerr)
+	}
+	want := []LMTPStatus{
+		{"unknown@example.com", 550, "5.1.1 No such user"},
+		{"ok@example.com", 250, "2.0.0 Saved"},
+		{"other@example.com", 250, "2.0.0 Saved"},
+	}
+	if !reflect.DeepEqual(statuses, want) {
+		t.Fatalf("expected %+v, got %+v", want, statuses)
+	}
+	if len(s.Messages()) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(s.Messages()))
+	}
+}
+
+func TestSendLMTPAddresses(t *testing.T) {
+	s := newTestServer(t)
+	s.lmtp = func(rcpt string) string { return "250 2.0.0 Saved" }
+
+	m := NewMessage("Hi", "this is the body")
+	m.From = "Alice <alice@example.com>"
+	m.To = []string{"Bob <bob@example.com>"}
+	conn, err := net.Dial("tcp", s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SendLMTP(conn, m); err != nil {
+		t.Fatal(err)
+	}
+
+	m.EnvelopeFrom = "bounces@example.com"
+	if conn, err = net.Dial("tcp", s.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SendLMTP(conn, m); err != nil {
+		t.Fatal(err)
+	}
+
+	cmds := strings.Join(s.Commands(), "\n")
+	for _, want := range []string{"MAIL FROM:<alice@example.com>\nRCPT TO:<bob@example.com>\n", "MAIL FROM:<bounces@example.com>\n"} {
+		if !strings.Contains(cmds, want) {
+			t.Fatalf("missing %q in:\n%s", want, cmds)
+		}
+	}
+}
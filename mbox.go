@@ -0,0 +1,55 @@
+package email
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/mail"
+	"os"
+	"regexp"
+	"time"
+)
+
+// SaveEML writes the message to the file path, usually with an .eml
+// extension, that mail clients can open. The line endings are CRLF
+// unless UnixLineEndings is set.
+func (m *Message) SaveEML(path string) error {
+	var b bytes.Buffer
+	if _, err := m.WriteTo(&b); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, m.lineEndings(b.Bytes()), 0644)
+}
+
+var mboxFromRe = regexp.MustCompile(`(?m)^(>*From )`)
+
+// AppendMbox appends the message to the mbox file path, which is created
+// if needed. It uses the mboxrd format: the message starts with a "From "
+// line, the lines of the message starting with "From ", after any number
+// of ">", are escaped with another ">", and the line endings are LF.
+func (m *Message) AppendMbox(path string) error {
+	var b bytes.Buffer
+	if _, err := m.WriteTo(&b); err != nil {
+		return err
+	}
+
+	sender := "MAILER-DAEMON"
+	if a, err := mail.ParseAddress(m.From); err == nil {
+		sender = a.Address
+	}
+	data := bytes.Replace(b.Bytes(), []byte("\r\n"), []byte("\n"), -1)
+	data = mboxFromRe.ReplaceAll(data, []byte(">$1"))
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	var out bytes.Buffer
+	out.WriteString("From " + sender + " " + nowFunc().UTC().Format(time.ANSIC) + "\n")
+	out.Write(data)
+	out.WriteString("\n")
+	if _, err := f.Write(out.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,93 @@
+package email
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/mail"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSaveEML(t *testing.T) {
+	m := NewMessage("Hi", "this is the body")
+	m.From = "from@example.com"
+	m.To = []string{"to@example.com"}
+
+	path := filepath.Join(t.TempDir(), "message.eml")
+	if err := m.SaveEML(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Header.Get("Subject") != "Hi" {
+		t.Fatalf("unexpected message:\n%s", data)
+	}
+}
+
+func TestAppendMbox(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sent.mbox")
+	for _, body := range []string{"From here on\r\n>From quoted\r\nnot From", "second"} {
+		m := NewMessage("Hi", body)
+		m.From = "Alice <alice@example.com>"
+		m.To = []string{"to@example.com"}
+		if err := m.AppendMbox(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mbox := string(data)
+	if strings.Count(mbox, "From alice@example.com ") != 2 || !strings.HasPrefix(mbox, "From alice@example.com ") {
+		t.Fatalf("unexpected separators:\n%s", mbox)
+	}
+	if !strings.Contains(mbox, "\n\n>From here on\n>>From quoted\nnot From\n") || strings.Contains(mbox, "\r") {
+		t.Fatalf("body not escaped:\n%s", mbox)
+	}
+	if !strings.HasSuffix(mbox, "\n\nsecond\n\n") {
+		t.Fatalf("unexpected end of the mbox:\n%s", mbox)
+	}
+}
+
+func TestUnixLineEndings(t *testing.T) {
+	m := NewMessage("Hi", "first line\r\nsecond line")
+	m.From = "from@example.com"
+	m.To = []string{"to@example.com"}
+	m.UnixLineEndings = true
+
+	path := filepath.Join(t.TempDir(), "message.eml")
+	if err := m.SaveEML(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("\r")) || !strings.HasSuffix(string(data), "\n\nfirst line\nsecond line\n") {
+		t.Fatalf("unexpected line endings: %q", data)
+	}
+	if b := m.Bytes(); !bytes.Equal(b[bytes.Index(b, []byte("MIME")):], data[bytes.Index(data, []byte("MIME")):]) {
+		t.Fatalf("Bytes differs from the saved file: %q", b)
+	}
+
+	// the wire format is not affected
+	var b bytes.Buffer
+	if _, err := m.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(b.String(), "\n"); n == 0 || n != strings.Count(b.String(), "\r\n") {
+		t.Fatalf("unexpected line endings on the wire: %q", b.String())
+	}
+	if err := m.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,74 @@
+package email
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"net/smtp"
+	"strings"
+	"text/template"
+)
+
+// MergeResult is the outcome of sending the message of a recipient of
+// SendMerge.
+type MergeResult struct {
+	Recipient string
+	Result    *Result
+	Err       error
+}
+
+// SendMerge sends a copy of m to each of the recipients over a single
+// connection, with the {{.Key}} placeholders of the subject and the body
+// replaced by the values of the recipient. The "Email" value is the
+// address of the recipient, which replaces the recipients of m. An HTML
+// body is executed as an html/template, so the values are escaped.
+//
+// An error is returned if the subject or the body are not valid
+// templates; the errors of each recipient are in its MergeResult.
+// skipverify skips the TLS certificate validation (insecure), as in Send.
+func SendMerge(addr string, auth smtp.Auth, m *Message, recipients []map[string]string, skipverify bool) ([]MergeResult, error) {
+	subject, err := template.New("subject").Option("missingkey=error").Parse(m.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("email: parsing subject template: %v", err)
+	}
+	var body interface {
+		Execute(w io.Writer, data interface{}) error
+	}
+	if m.BodyContentType == "text/html" {
+		body, err = htmltemplate.New("body").Option("missingkey=error").Parse(m.Body)
+	} else {
+		body, err = template.New("body").Option("missingkey=error").Parse(m.Body)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("email: parsing body template: %v", err)
+	}
+
+	c := NewClient(addr, auth, skipverify)
+	defer c.Close()
+
+	results := make([]MergeResult, len(recipients))
+	for i, data := range recipients {
+		results[i].Recipient = data["Email"]
+		if data["Email"] == "" {
+			results[i].Err = fmt.Errorf("email: missing Email of recipient %d", i)
+			continue
+		}
+
+		var s, b strings.Builder
+		if err := subject.Execute(&s, data); err != nil {
+			results[i].Err = fmt.Errorf("email: executing subject template: %v", err)
+			continue
+		}
+		if err := body.Execute(&b, data); err != nil {
+			results[i].Err = fmt.Errorf("email: executing body template: %v", err)
+			continue
+		}
+
+		rm := m.Clone()
+		rm.To, rm.Cc, rm.Bcc = []string{data["Email"]}, nil, nil
+		rm.Subject, rm.Body = s.String(), b.String()
+		results[i].Result, results[i].Err = c.SendResult(rm)
+		rm.RemoveSpooled()
+	}
+	return results, nil
+}
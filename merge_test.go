@@ -0,0 +1,49 @@
+package email
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSendMerge(t *testing.T) {
+	s := newTestServer(t)
+
+	m := NewHTMLMessage("Hi {{.Name}}", "<p>Hello {{.Name}}</p>")
+	m.From = "from@example.com"
+	m.To = []string{"list@example.com"}
+	results, err := SendMerge(s.Addr(), nil, m, []map[string]string{
+		{"Email": "alice@example.com", "Name": "Alice"},
+		{"Email": "bob@example.com", "Name": "<Bob>"},
+		{"Email": "carol@example.com"},
+		{"Name": "Dave"},
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 4 || results[0].Err != nil || results[1].Err != nil || results[2].Err == nil || results[3].Err == nil {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+	if results[1].Recipient != "bob@example.com" || results[1].Result == nil {
+		t.Fatalf("unexpected result: %+v", results[1])
+	}
+
+	msgs := s.Messages()
+	if len(msgs) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(msgs))
+	}
+	if !strings.Contains(msgs[0], "To: alice@example.com\nSubject: Hi Alice\n") || !strings.Contains(msgs[0], "<p>Hello Alice</p>") {
+		t.Fatalf("unexpected first message:\n%s", msgs[0])
+	}
+	if !strings.Contains(msgs[1], "Subject: Hi <Bob>\n") || !strings.Contains(msgs[1], "<p>Hello &lt;Bob&gt;</p>") {
+		t.Fatalf("unexpected second message:\n%s", msgs[1])
+	}
+	if m.Subject != "Hi {{.Name}}" || m.To[0] != "list@example.com" {
+		t.Fatal("message modified")
+	}
+
+	m.Subject = "Hi {{.Name"
+	if _, err := SendMerge(s.Addr(), nil, m, nil, false); err == nil {
+		t.Fatal("expected an error for an invalid template")
+	}
+}
@@ -0,0 +1,83 @@
+package email
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Translation is a version of the message in a language.
+type Translation struct {
+	// Language is the language tag, like "en" or "pt-BR".
+	Language string
+	// Type is how the translation was made: "original", "human" or
+	// "automated".
+	Type    string
+	Subject string
+	Body    string
+	// BodyContentType defaults to text/plain.
+	BodyContentType string
+}
+
+var languageRe = regexp.MustCompile(`^[A-Za-z]{1,8}(-[A-Za-z0-9]{1,8})*$`)
+
+// AddTranslation adds a version of the message in the language lang. With
+// translations the message is written as multipart/multilingual (RFC 8255):
+// the body of the message is a preface, in all the languages or in none,
+// for the clients that can not choose a translation, followed by the
+// translations as embedded messages. typ is "original", "human" or
+// "automated".
+func (m *Message) AddTranslation(lang, typ, subject, body string) error {
+	if !languageRe.MatchString(lang) {
+		return fmt.Errorf("email: invalid language tag %q", lang)
+	}
+	switch typ {
+	case "original", "human", "automated":
+	default:
+		return fmt.Errorf("email: invalid translation type %q", typ)
+	}
+
+	m.Translations = append(m.Translations, Translation{
+		Language: lang,
+		Type:     typ,
+		Subject:  subject,
+		Body:     body,
+	})
+	return nil
+}
+
+func (m *Message) writeMultilingual(buf *bufio.Writer, b boundaries) error {
+	inner := m.innerPart(partMultilingual)
+	buf.WriteString("--" + b.multilingual + "\r\n")
+	writePartHeaders(buf, m.partHeaders(inner, b))
+	if err := m.writePart(buf, inner, b, nil); err != nil {
+		return err
+	}
+
+	for _, t := range m.Translations {
+		contentType := t.BodyContentType
+		if contentType == "" {
+			contentType = "text/plain"
+		}
+
+		buf.WriteString("--" + b.multilingual + "\r\n")
+		writePartHeaders(buf, map[string]string{
+			"Content-Type":             "message/rfc822",
+			"Content-Language":         t.Language,
+			"Content-Translation-Type": t.Type,
+		})
+
+		buf.WriteString("Subject: " + m.encodeWord(t.Subject) + "\r\n")
+		buf.WriteString("MIME-Version: 1.0\r\n")
+		body := m.transcode(t.Body)
+		buf.WriteString("Content-Type: " + m.withCharset(contentType) + "\r\n")
+		buf.WriteString("Content-Transfer-Encoding: " + m.encoding(body) + "\r\n\r\n")
+		if err := writeEncoded(buf, m.encoding(body), strings.NewReader(body)); err != nil {
+			return err
+		}
+	}
+
+	buf.WriteString("--" + b.multilingual + "--\r\n")
+	return nil
+}
@@ -0,0 +1,74 @@
+package email
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"testing"
+)
+
+func TestMultilingual(t *testing.T) {
+	m := NewMessage("Order shipped / Pedido enviado", "English and Spanish versions follow.")
+	m.From = "from@example.com"
+	m.To = []string{"to@example.com"}
+	if err := m.AddTranslation("en", "original", "Order shipped", "Your order is on its way."); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddTranslation("es", "human", "Pedido enviado", "Tu pedido está en camino."); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range [][2]string{{"e n", "human"}, {"", "human"}, {"fr", "machine"}} {
+		if err := m.AddTranslation(tt[0], tt[1], "", ""); err == nil {
+			t.Fatalf("expected an error for %q", tt)
+		}
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(m.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/multilingual" {
+		t.Fatalf("unexpected Content-Type %q", msg.Header.Get("Content-Type"))
+	}
+
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	p, err := mr.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadAll(p); string(data) != "English and Spanish versions follow." {
+		t.Fatalf("unexpected preface %q", data)
+	}
+
+	dec := new(mime.WordDecoder)
+	for _, want := range m.Translations {
+		p, err := mr.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Header.Get("Content-Type") != "message/rfc822" ||
+			p.Header.Get("Content-Language") != want.Language ||
+			p.Header.Get("Content-Translation-Type") != want.Type {
+			t.Fatalf("unexpected headers of the %s part: %v", want.Language, p.Header)
+		}
+		inner, err := mail.ReadMessage(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		subject, _ := dec.DecodeHeader(inner.Header.Get("Subject"))
+		body, _ := ioutil.ReadAll(inner.Body)
+		if subject != want.Subject || string(body) != want.Body {
+			t.Fatalf("unexpected %s translation: %q %q", want.Language, subject, body)
+		}
+	}
+	if _, err := mr.NextPart(); err != io.EOF {
+		t.Fatalf("expected the end of the parts, got %v", err)
+	}
+	if err := m.SelfCheck(); err != nil {
+		t.Fatal(err)
+	}
+}
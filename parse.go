@@ -0,0 +1,147 @@
+package email
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+)
+
+// FromMailMessage converts msg, as returned by mail.ReadMessage, to a
+// Message. The addresses, the subject and the threading headers are
+// copied, the first text part that is not an attachment is decoded into
+// Body, and the other parts become Attachments. An HTML body with a plain
+// text alternative is converted to AutoPlainText, so the text is derived
+// again from the HTML. The body is consumed.
+func FromMailMessage(msg *mail.Message) (*Message, error) {
+	dec := new(mime.WordDecoder)
+	header := func(name string) string {
+		v := msg.Header.Get(name)
+		if d, err := dec.DecodeHeader(v); err == nil {
+			return d
+		}
+		return v
+	}
+	addresses := func(name string) []string {
+		var list []string
+		for _, a := range strings.Split(msg.Header.Get(name), ",") {
+			if a = strings.TrimSpace(a); a != "" {
+				list = append(list, a)
+			}
+		}
+		if addrs, err := msg.Header.AddressList(name); err == nil {
+			list = list[:0]
+			for _, a := range addrs {
+				list = append(list, a.String())
+			}
+		}
+		return list
+	}
+
+	m := newMessage(header("Subject"), "", "text/plain")
+	m.From = header("From")
+	m.Sender = header("Sender")
+	m.ReplyTo = header("Reply-To")
+	m.To = addresses("To")
+	m.Cc = addresses("Cc")
+	m.Comments = header("Comments")
+	m.Precedence = msg.Header.Get("Precedence")
+	m.MessageID = strings.Trim(msg.Header.Get("Message-ID"), " <>")
+	m.InReplyTo = strings.Trim(msg.Header.Get("In-Reply-To"), " <>")
+	for _, id := range strings.Fields(msg.Header.Get("References")) {
+		m.References = append(m.References, strings.Trim(id, "<>"))
+	}
+
+	found := false
+	if err := m.addParsedPart(textproto.MIMEHeader(msg.Header), msg.Body, &found); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// addParsedPart adds the part with header h to m: the first text part
+// that is not an attachment becomes the body, and found is set, and the
+// other parts are added as attachments.
+func (m *Message) addParsedPart(h textproto.MIMEHeader, body io.Reader, found *bool) error {
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", nil
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		alternative := mediaType == "multipart/alternative" && !*found
+		r := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := r.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("email: invalid %s part: %v", mediaType, err)
+			}
+			if alternative && *found {
+				// the alternatives are in increasing order of
+				// preference, keep the HTML one if any
+				if t, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type")); t == "text/html" {
+					html := false
+					if err := m.addParsedPart(p.Header, p, &html); err != nil {
+						return err
+					}
+					m.AutoPlainText = true
+				}
+				continue
+			}
+			if err := m.addParsedPart(p.Header, p, found); err != nil {
+				return err
+			}
+		}
+	}
+
+	switch cte := strings.ToLower(h.Get("Content-Transfer-Encoding")); cte {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return fmt.Errorf("email: decoding %s part: %v", mediaType, err)
+	}
+
+	disposition, dparams, _ := mime.ParseMediaType(h.Get("Content-Disposition"))
+	filename := dparams["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+	if !*found && (mediaType == "text/plain" || mediaType == "text/html") && disposition != "attachment" && filename == "" {
+		text, err := decodeCharset(params["charset"], data)
+		if err != nil {
+			return err
+		}
+		m.Body, m.BodyContentType = text, mediaType
+		*found = true
+		return nil
+	}
+
+	if filename == "" {
+		filename = fmt.Sprintf("part%d", len(m.Attachments)+1)
+	}
+	key := m.unusedAttachmentName(filename)
+	description, _ := new(mime.WordDecoder).DecodeHeader(h.Get("Content-Description"))
+	m.setAttachment(key, &Attachment{
+		Filename:        filename,
+		Data:            data,
+		Inline:          disposition == "inline",
+		ContentType:     mediaType,
+		ContentID:       strings.Trim(h.Get("Content-ID"), " <>"),
+		ContentLocation: h.Get("Content-Location"),
+		Description:     description,
+	})
+	return nil
+}
@@ -0,0 +1,73 @@
+package email
+
+import (
+	"bytes"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func TestFromMailMessage(t *testing.T) {
+	raw := "From: Alice <alice@example.com>\r\n" +
+		"To: bob@example.com, Carol <carol@example.com>\r\n" +
+		"Subject: =?iso-8859-1?q?Caf=E9?=\r\n" +
+		"Message-ID: <2@example.com>\r\n" +
+		"References: <0@example.com> <1@example.com>\r\n" +
+		"Content-Type: text/plain; charset=iso-8859-1\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"Un caf=E9?\r\n"
+	msg, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := FromMailMessage(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.From != "Alice <alice@example.com>" || strings.Join(m.To, ",") != `<bob@example.com>,"Carol" <carol@example.com>` {
+		t.Fatalf("unexpected addresses %q %q", m.From, m.To)
+	}
+	if m.Subject != "Café" || m.MessageID != "2@example.com" || strings.Join(m.References, " ") != "0@example.com 1@example.com" {
+		t.Fatalf("unexpected headers %q %q %q", m.Subject, m.MessageID, m.References)
+	}
+	if m.Body != "Un café?\r\n" || m.BodyContentType != "text/plain" || len(m.Attachments) != 0 {
+		t.Fatalf("unexpected body %q of type %s", m.Body, m.BodyContentType)
+	}
+}
+
+func TestFromMailMessageMultipart(t *testing.T) {
+	orig := NewHTMLMessage("Hi", "<p>Hello</p>")
+	orig.From = "alice@example.com"
+	orig.To = []string{"bob@example.com"}
+	orig.AutoPlainText = true
+	orig.Attachments["a.txt"] = &Attachment{Filename: "a.txt", Data: []byte("attachment"), ContentType: "text/plain"}
+	orig.Attachments["logo.png"] = &Attachment{Filename: "logo.png", Data: []byte("\x89PNG"), Inline: true, ContentType: "image/png", ContentID: "logo"}
+	orig.Attachments["b.txt"] = &Attachment{Filename: "a.txt", Data: []byte("second"), ContentType: "text/plain"}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(orig.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := FromMailMessage(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Body != "<p>Hello</p>" || m.BodyContentType != "text/html" || !m.AutoPlainText {
+		t.Fatalf("unexpected body %q of type %s", m.Body, m.BodyContentType)
+	}
+	a, logo := m.Attachments["a.txt"], m.Attachments["logo.png"]
+	if a == nil || string(a.Data) != "attachment" || a.Inline || a.ContentType != "text/plain" {
+		t.Fatalf("unexpected attachment %+v", a)
+	}
+	if logo == nil || string(logo.Data) != "\x89PNG" || !logo.Inline || logo.ContentID != "logo" {
+		t.Fatalf("unexpected inline attachment %+v", logo)
+	}
+	// a repeated filename gets a numeric suffix in the key
+	if dup := m.Attachments["a-2.txt"]; dup == nil || string(dup.Data) != "second" || dup.Filename != "a.txt" {
+		t.Fatalf("unexpected attachments %v", m.attachmentNames())
+	}
+	if len(m.Attachments) != 3 {
+		t.Fatalf("unexpected attachments %v", m.Attachments)
+	}
+}
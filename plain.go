@@ -0,0 +1,111 @@
+package email
+
+import (
+	"io"
+	"time"
+)
+
+// plainASCII reports whether m is a plain text message in ASCII with only
+// the basic headers, From, Date, To, Cc, Subject, Reply-To and Message-ID,
+// and no attachments, which writePlain writes without building the MIME
+// tree. It is the common case of transactional messages.
+func (m *Message) plainASCII() bool {
+	if m.BodyContentType != "text/plain" || m.BodyReader != nil || m.BodyEncoding != "" ||
+		m.BodyFilename != "" || m.DKIMSignature != "" || m.DeliveryStatus != nil ||
+		len(m.Attachments) > 0 || len(m.Translations) > 0 {
+		return false
+	}
+	if len(m.Trace) > 0 || m.Sender != "" || !m.Expires.IsZero() || m.Comments != "" ||
+		len(m.Keywords) > 0 || m.InReplyTo != "" || len(m.References) > 0 ||
+		m.OriginalMessageID != "" || m.Precedence != "" || m.Sensitivity != "" ||
+		m.TLSOptional || m.ReadReceiptTo != "" || m.ReportAbuse != "" ||
+		len(m.AutoResponseSuppress) > 0 || len(m.ListHeaders) > 0 ||
+		len(m.ValidSince) > 0 || len(m.ExtraHeaders) > 0 {
+		return false
+	}
+	if !isPrintableASCII(m.Subject) {
+		return false
+	}
+
+	// the body is written as is with the 7bit encoding
+	line := 0
+	for i := 0; i < len(m.Body); i++ {
+		switch c := m.Body[i]; {
+		case c == '\n':
+			line = 0
+			continue
+		case c >= 0x80 || c == 0:
+			return false
+		}
+		if line++; line > 998 {
+			return false
+		}
+	}
+	return true
+}
+
+// writePlain writes the message m, for which plainASCII is true, to w with
+// a single write. The bytes are the same as those of the general path.
+func (m *Message) writePlain(w io.Writer) (int64, error) {
+	t := m.date
+	if t.IsZero() {
+		t = nowFunc()
+	}
+	if m.Location != nil {
+		t = t.In(m.Location)
+	}
+
+	b := make([]byte, 0, 256+len(m.Body))
+	add := func(name, value string) {
+		b = append(b, name...)
+		b = append(b, ": "...)
+		b = append(b, value...)
+		b = append(b, "\r\n"...)
+	}
+
+	add("From", m.From)
+	b = append(b, "Date: "...)
+	b = t.AppendFormat(b, time.RFC1123Z)
+	b = append(b, "\r\n"...)
+	b = append(b, "To: "...)
+	for i, to := range m.To {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = append(b, to...)
+	}
+	b = append(b, "\r\n"...)
+	if len(m.Cc) > 0 {
+		b = append(b, "Cc: "...)
+		for i, cc := range m.Cc {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = append(b, cc...)
+		}
+		b = append(b, "\r\n"...)
+	}
+	add("Subject", m.Subject)
+	if m.ReplyTo != "" {
+		add("Reply-To", m.ReplyTo)
+	}
+	if m.MessageID != "" {
+		add("Message-ID", msgID(m.MessageID))
+	}
+	add("MIME-Version", "1.0")
+	if m.OmitCharset {
+		add("Content-Type", "text/plain")
+	} else {
+		add("Content-Type", "text/plain; charset="+m.charset())
+	}
+	add("Content-Transfer-Encoding", "7bit")
+	b = append(b, "\r\n"...)
+
+	b = append(b, m.Body...)
+	if len(m.Body) == 0 || m.Body[len(m.Body)-1] != '\n' {
+		b = append(b, "\r\n"...)
+	}
+
+	n, err := w.Write(b)
+	return int64(n), err
+}
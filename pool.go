@@ -0,0 +1,70 @@
+package email
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrPoolClosed is returned by Pool.Send after the pool is closed.
+var ErrPoolClosed = errors.New("email: pool closed")
+
+// Pool sends messages concurrently over up to n connections to a relay.
+// It is safe for concurrent use.
+type Pool struct {
+	clients chan *Client
+	n       int
+	done    chan struct{}
+	once    sync.Once
+	err     error
+}
+
+// NewPool returns a Pool of n clients configured like c, which is not
+// used. n is at least 1. A connection that fails is replaced by a new one
+// on the next message sent through it.
+func NewPool(c *Client, n int) *Pool {
+	if n < 1 {
+		n = 1
+	}
+	p := &Pool{
+		clients: make(chan *Client, n),
+		n:       n,
+		done:    make(chan struct{}),
+	}
+	for i := 0; i < n; i++ {
+		pc := *c
+		pc.c, pc.conn = nil, nil
+		p.clients <- &pc
+	}
+	return p
+}
+
+// Send sends m over the first available connection, waiting for one if
+// all of them are in use.
+func (p *Pool) Send(m *Message) error {
+	select {
+	case c := <-p.clients:
+		defer func() { p.clients <- c }()
+		select {
+		case <-p.done:
+			return ErrPoolClosed
+		default:
+		}
+		return c.Send(m)
+	case <-p.done:
+		return ErrPoolClosed
+	}
+}
+
+// Close waits for the messages being sent and closes the connections.
+func (p *Pool) Close() error {
+	p.once.Do(func() {
+		close(p.done)
+		for i := 0; i < p.n; i++ {
+			c := <-p.clients
+			if err := c.Close(); err != nil && p.err == nil {
+				p.err = err
+			}
+		}
+	})
+	return p.err
+}
@@ -0,0 +1,75 @@
+package email
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestPool(t *testing.T) {
+	s := newTestServer(t)
+
+	p := NewPool(NewClient(s.Addr(), nil, false), 3)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m := NewMessage("Hi", "this is the body")
+			m.From = "from@example.com"
+			m.To = []string{"to@example.com"}
+			errs <- p.Send(m)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Send(NewMessage("Hi", "")); err != ErrPoolClosed {
+		t.Fatalf("expected ErrPoolClosed, got %v", err)
+	}
+
+	if n := len(s.Messages()); n != 20 {
+		t.Fatalf("expected 20 messages, got %d", n)
+	}
+	conns, quits := 0, 0
+	for _, cmd := range s.Commands() {
+		if strings.HasPrefix(cmd, "EHLO") {
+			conns++
+		}
+		if cmd == "QUIT" {
+			quits++
+		}
+	}
+	if conns > 3 || quits != conns {
+		t.Fatalf("%d connections opened and %d closed", conns, quits)
+	}
+}
+
+func TestPoolSize(t *testing.T) {
+	s := newTestServer(t)
+	for _, n := range []int{0, -1} {
+		p := NewPool(NewClient(s.Addr(), nil, false), n)
+		m := NewMessage("Hi", "this is the body")
+		m.From = "from@example.com"
+		m.To = []string{"to@example.com"}
+		if err := p.Send(m); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(s.Messages()); n != 2 {
+		t.Fatalf("expected 2 messages, got %d", n)
+	}
+}
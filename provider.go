@@ -0,0 +1,42 @@
+package email
+
+import (
+	"fmt"
+	"strings"
+)
+
+// providers are the submission servers of the known providers, which all
+// use STARTTLS on port 587.
+var providers = map[string]string{
+	"gmail":     "smtp.gmail.com:587",
+	"office365": "smtp.office365.com:587",
+	"sendgrid":  "smtp.sendgrid.net:587",
+	"mailgun":   "smtp.mailgun.org:587",
+	"ses":       "email-smtp.us-east-1.amazonaws.com:587",
+}
+
+// ProviderConfig returns a Client for the submission server of a known
+// provider: "gmail", "office365", "sendgrid", "mailgun" or "ses", which
+// uses the us-east-1 region unless it is given as in "ses:eu-west-1". The
+// caller sets Auth with its credentials, usually PlainAuth for the host
+// of Addr; SendGrid expects the user "apikey" and an API key as password.
+// The messages are sent with STARTTLS and, for Gmail and Office 365, which
+// reject or rewrite a From other than the authenticated user, with
+// SenderFromAuth.
+func ProviderConfig(name string) (*Client, error) {
+	name, region := strings.ToLower(name), ""
+	if i := strings.IndexByte(name, ':'); i >= 0 {
+		name, region = name[:i], name[i+1:]
+	}
+	addr, ok := providers[name]
+	if !ok || (region != "" && name != "ses") {
+		return nil, fmt.Errorf("email: unknown provider %q", name)
+	}
+	if region != "" {
+		addr = "email-smtp." + region + ".amazonaws.com:587"
+	}
+
+	c := NewClient(addr, nil, false)
+	c.SenderFromAuth = name == "gmail" || name == "office365"
+	return c, nil
+}
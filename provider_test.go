@@ -0,0 +1,31 @@
+package email
+
+import "testing"
+
+func TestProviderConfig(t *testing.T) {
+	for _, tt := range []struct {
+		name, addr     string
+		senderFromAuth bool
+	}{
+		{"gmail", "smtp.gmail.com:587", true},
+		{"Office365", "smtp.office365.com:587", true},
+		{"sendgrid", "smtp.sendgrid.net:587", false},
+		{"mailgun", "smtp.mailgun.org:587", false},
+		{"ses", "email-smtp.us-east-1.amazonaws.com:587", false},
+		{"ses:eu-west-1", "email-smtp.eu-west-1.amazonaws.com:587", false},
+	} {
+		c, err := ProviderConfig(tt.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Addr != tt.addr || c.SenderFromAuth != tt.senderFromAuth || c.SkipVerify || c.DisableTLS || c.Auth != nil {
+			t.Fatalf("unexpected config of %s: %+v", tt.name, c)
+		}
+	}
+
+	for _, name := range []string{"hotmail", "gmail:eu-west-1", ""} {
+		if _, err := ProviderConfig(name); err == nil {
+			t.Fatalf("expected an error for %q", name)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package email
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// proxySignature starts the headers of version 2 of the PROXY protocol.
+var proxySignature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// proxyHeader returns the PROXY protocol header of the given version for
+// a connection from src to dst, as sent by HAProxy to the servers behind
+// it.
+func proxyHeader(version int, src, dst net.Addr) ([]byte, error) {
+	s, ok1 := src.(*net.TCPAddr)
+	d, ok2 := dst.(*net.TCPAddr)
+	if !ok1 || !ok2 {
+		return nil, errors.New("email: the PROXY protocol needs a TCP connection")
+	}
+	ipv4 := s.IP.To4() != nil && d.IP.To4() != nil
+
+	switch version {
+	case 1:
+		proto := "TCP6"
+		if ipv4 {
+			proto = "TCP4"
+		}
+		return []byte(fmt.Sprintf("PROXY %s %s %s %d %d\r\n", proto, s.IP, d.IP, s.Port, d.Port)), nil
+	case 2:
+		h := append([]byte(nil), proxySignature...)
+		var addrs []byte
+		if ipv4 {
+			// version 2, PROXY command, TCP over IPv4
+			h = append(h, 0x21, 0x11)
+			addrs = append(append(addrs, s.IP.To4()...), d.IP.To4()...)
+		} else {
+			h = append(h, 0x21, 0x21)
+			addrs = append(append(addrs, s.IP.To16()...), d.IP.To16()...)
+		}
+		addrs = binary.BigEndian.AppendUint16(addrs, uint16(s.Port))
+		addrs = binary.BigEndian.AppendUint16(addrs, uint16(d.Port))
+		h = binary.BigEndian.AppendUint16(h, uint16(len(addrs)))
+		return append(h, addrs...), nil
+	}
+	return nil, fmt.Errorf("email: unknown PROXY protocol version %d", version)
+}
@@ -0,0 +1,93 @@
+package email
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+)
+
+// readProxyHeader reads a PROXY protocol header of version 1 or 2 and
+// returns the source and destination addresses.
+func readProxyHeader(r io.Reader) (src, dst string, err error) {
+	sig := make([]byte, len(proxySignature))
+	if _, err := io.ReadFull(r, sig); err != nil {
+		return "", "", err
+	}
+
+	if !bytes.Equal(sig, proxySignature) {
+		line := sig
+		b := make([]byte, 1)
+		for !bytes.HasSuffix(line, []byte("\r\n")) && len(line) < 107 {
+			if _, err := r.Read(b); err != nil {
+				return "", "", err
+			}
+			line = append(line, b[0])
+		}
+		var proto, srcIP, dstIP string
+		var srcPort, dstPort int
+		if _, err := fmt.Sscanf(string(line), "PROXY %s %s %s %d %d\r\n", &proto, &srcIP, &dstIP, &srcPort, &dstPort); err != nil {
+			return "", "", fmt.Errorf("invalid header %q: %v", line, err)
+		}
+		return net.JoinHostPort(srcIP, fmt.Sprint(srcPort)), net.JoinHostPort(dstIP, fmt.Sprint(dstPort)), nil
+	}
+
+	h := make([]byte, 4)
+	if _, err := io.ReadFull(r, h); err != nil {
+		return "", "", err
+	}
+	addrs := make([]byte, binary.BigEndian.Uint16(h[2:]))
+	if _, err := io.ReadFull(r, addrs); err != nil {
+		return "", "", err
+	}
+	n := 4
+	if h[1] == 0x21 {
+		n = 16
+	} else if h[0] != 0x21 || h[1] != 0x11 {
+		return "", "", fmt.Errorf("unexpected header % x", h)
+	}
+	if len(addrs) != 2*n+4 {
+		return "", "", errors.New("unexpected length")
+	}
+	srcPort, dstPort := binary.BigEndian.Uint16(addrs[2*n:]), binary.BigEndian.Uint16(addrs[2*n+2:])
+	return net.JoinHostPort(net.IP(addrs[:n]).String(), fmt.Sprint(srcPort)),
+		net.JoinHostPort(net.IP(addrs[n:2*n]).String(), fmt.Sprint(dstPort)), nil
+}
+
+func TestClientProxyProtocol(t *testing.T) {
+	for _, version := range []int{1, 2} {
+		s := newTestServer(t)
+		headers := make(chan [2]string, 1)
+		s.proxy = func(conn net.Conn) error {
+			src, dst, err := readProxyHeader(conn)
+			if err != nil {
+				return err
+			}
+			if src != conn.RemoteAddr().String() || dst != conn.LocalAddr().String() {
+				return fmt.Errorf("unexpected addresses %s %s", src, dst)
+			}
+			headers <- [2]string{src, dst}
+			return nil
+		}
+
+		m := NewMessage("Hi", "this is the body")
+		m.From = "from@example.com"
+		m.To = []string{"to@example.com"}
+		c := NewClient(s.Addr(), nil, false)
+		c.ProxyProtocol = version
+		if err := c.Send(m); err != nil {
+			t.Fatalf("version %d: %v", version, err)
+		}
+		c.Close()
+		if h := <-headers; h[1] != s.Addr() {
+			t.Fatalf("version %d: unexpected destination %s", version, h[1])
+		}
+	}
+
+	if _, err := proxyHeader(3, &net.TCPAddr{}, &net.TCPAddr{}); err == nil {
+		t.Fatal("expected an error for an unknown version")
+	}
+}
@@ -0,0 +1,67 @@
+package email
+
+import (
+	"strings"
+)
+
+// BuildReply returns a plain text reply from from to original, with body
+// followed by the quoted original body. The subject gets a "Re: " prefix
+// and the threading headers are set from the MessageID and References of
+// the original.
+func BuildReply(original *Message, from, body string) *Message {
+	m := NewMessage("", body+"\r\n\r\n"+quote(original))
+	m.From = from
+
+	if original.ReplyTo != "" {
+		m.To = []string{original.ReplyTo}
+	} else {
+		m.To = []string{original.From}
+	}
+
+	m.SetReply(original)
+	return m
+}
+
+// SetReply makes m a reply to original: the subject gets a "Re: " prefix
+// and In-Reply-To and References are set from the MessageID and the
+// threading headers of the original, as described in RFC 5322.
+func (m *Message) SetReply(original *Message) {
+	m.Subject = replySubject(original.Subject)
+	if original.MessageID == "" {
+		return
+	}
+
+	refs := original.References
+	if len(refs) == 0 && original.InReplyTo != "" {
+		refs = []string{original.InReplyTo}
+	}
+	m.InReplyTo = original.MessageID
+	m.References = append(append([]string(nil), refs...), original.MessageID)
+}
+
+// replySubject returns subject with a "Re: " prefix, unless it has one.
+func replySubject(subject string) string {
+	if len(subject) >= 3 && strings.EqualFold(subject[:3], "re:") {
+		return subject
+	}
+	return "Re: " + subject
+}
+
+// quote returns the body of m prefixed with "> " and an attribution line.
+func quote(m *Message) string {
+	body := m.Body
+	if m.BodyContentType == "text/html" {
+		body = htmlToText(body)
+	}
+
+	lines := strings.Split(strings.Replace(body, "\r\n", "\n", -1), "\n")
+	for i, l := range lines {
+		if strings.HasPrefix(l, ">") {
+			lines[i] = ">" + l
+		} else {
+			lines[i] = "> " + l
+		}
+	}
+
+	return m.From + " wrote:\r\n" + strings.Join(lines, "\r\n")
+}
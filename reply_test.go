@@ -0,0 +1,61 @@
+package email
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildReply(t *testing.T) {
+	original := NewMessage("Re: Lunch", "Tomorrow?\r\n> Friday?")
+	original.From = "alice@example.com"
+	original.To = []string{"bob@example.com"}
+	original.MessageID = "2@example.com"
+	original.References = []string{"1@example.com"}
+
+	m := BuildReply(original, "bob@example.com", "Sure.")
+
+	if m.Subject != "Re: Lunch" {
+		t.Fatalf("unexpected subject %q", m.Subject)
+	}
+	if m.From != "bob@example.com" || len(m.To) != 1 || m.To[0] != "alice@example.com" {
+		t.Fatalf("unexpected addresses: %q %q", m.From, m.To)
+	}
+	want := "Sure.\r\n\r\nalice@example.com wrote:\r\n> Tomorrow?\r\n>> Friday?"
+	if m.Body != want {
+		t.Fatalf("unexpected body %q", m.Body)
+	}
+
+	h := string(m.Headers())
+	if !strings.Contains(h, "In-Reply-To: <2@example.com>\r\n") ||
+		!strings.Contains(h, "References: <1@example.com> <2@example.com>\r\n") {
+		t.Fatalf("unexpected threading headers:\n%s", h)
+	}
+
+	original.ReplyTo = "list@example.com"
+	original.Subject = "Lunch"
+	m = BuildReply(original, "bob@example.com", "Sure.")
+	if m.Subject != "Re: Lunch" || m.To[0] != "list@example.com" {
+		t.Fatalf("unexpected reply: %q %q", m.Subject, m.To)
+	}
+}
+
+func TestSetReply(t *testing.T) {
+	original := NewMessage("RE: Lunch", "Tomorrow?")
+	original.MessageID = "2@example.com"
+	original.InReplyTo = "1@example.com"
+
+	m := NewMessage("", "Sure.")
+	m.SetReply(original)
+	if m.Subject != "RE: Lunch" || m.InReplyTo != "2@example.com" ||
+		strings.Join(m.References, " ") != "1@example.com 2@example.com" {
+		t.Fatalf("unexpected reply: %q %q %q", m.Subject, m.InReplyTo, m.References)
+	}
+
+	original.Subject = "Lunch"
+	original.MessageID = ""
+	m = NewMessage("", "Sure.")
+	m.SetReply(original)
+	if m.Subject != "Re: Lunch" || m.InReplyTo != "" || m.References != nil {
+		t.Fatalf("unexpected reply: %q %q %q", m.Subject, m.InReplyTo, m.References)
+	}
+}
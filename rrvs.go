@@ -0,0 +1,30 @@
+package email
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// SetRecipientValidSince adds a Require-Recipient-Valid-Since header
+// (RFC 7293) asking the receiving server not to deliver the message to addr
+// if the address changed owner after date. addr must be a bare address,
+// like "user@example.com", and date an RFC 5322 date, like
+// "Mon, 02 Jan 2006 15:04:05 -0700".
+func (m *Message) SetRecipientValidSince(addr, date string) error {
+	a, err := mail.ParseAddress(addr)
+	if err != nil || a.Name != "" || a.Address != addr {
+		return fmt.Errorf("email: invalid address %q", addr)
+	}
+	t, err := mail.ParseDate(date)
+	if err != nil || strings.ContainsAny(date, "\r\n") {
+		return fmt.Errorf("email: invalid date %q", date)
+	}
+
+	if m.ValidSince == nil {
+		m.ValidSince = make(map[string]string)
+	}
+	m.ValidSince[addr] = t.Format(time.RFC1123Z)
+	return nil
+}
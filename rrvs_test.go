@@ -0,0 +1,34 @@
+package email
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSetRecipientValidSince(t *testing.T) {
+	m := NewMessage("Hi", "this is the body")
+	m.To = []string{"b@example.com", "a@example.com"}
+	if err := m.SetRecipientValidSince("b@example.com", "Sat, 1 Feb 2014 09:00:00 +0100"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetRecipientValidSince("a@example.com", "Fri, 31 Jan 2014 12:30:00 -0500"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "Require-Recipient-Valid-Since: a@example.com; Fri, 31 Jan 2014 12:30:00 -0500\r\n" +
+		"Require-Recipient-Valid-Since: b@example.com; Sat, 01 Feb 2014 09:00:00 +0100\r\n"
+	if h := string(m.Headers()); !strings.Contains(h, want) {
+		t.Fatalf("unexpected headers:\n%s", h)
+	}
+
+	for _, tt := range [][2]string{
+		{"Someone <a@example.com>", "Fri, 31 Jan 2014 12:30:00 -0500"},
+		{"a@example.com\r\nBcc: x@example.com", "Fri, 31 Jan 2014 12:30:00 -0500"},
+		{"a@example.com", "2014-01-31T12:30:00Z"},
+		{"a@example.com", "Fri, 31 Jan 2014 12:30:00 -0500\r\nBcc: x@example.com"},
+	} {
+		if err := m.SetRecipientValidSince(tt[0], tt[1]); err == nil {
+			t.Fatalf("expected an error for %q", tt)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package email
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// Sender sends messages. It is implemented by Client and Pool, and by the
+// decorators below that can be combined to build a sending stack.
+type Sender interface {
+	Send(m *Message) error
+}
+
+// FallbackSender sends each message with the first Sender that accepts
+// it. The next one is tried when a Sender fails with a temporary error,
+// like a connection error or a 4xx reply, but not when the message is
+// rejected permanently with a 5xx reply, which is returned.
+type FallbackSender []Sender
+
+// Send sends m with the senders in order and returns the last error if
+// none of them accepts it.
+func (f FallbackSender) Send(m *Message) error {
+	err := errors.New("email: no senders")
+	for _, s := range f {
+		if err = s.Send(m); err == nil || IsPermanent(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// RateLimitedSender sends the messages with a Sender waiting at least an
+// interval between them. It is safe for concurrent use if the Sender is.
+type RateLimitedSender struct {
+	s        Sender
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// NewRateLimitedSender returns a RateLimitedSender that sends at most one
+// message every interval through s.
+func NewRateLimitedSender(s Sender, interval time.Duration) *RateLimitedSender {
+	return &RateLimitedSender{s: s, interval: interval}
+}
+
+// Send waits for its turn and sends m.
+func (r *RateLimitedSender) Send(m *Message) error {
+	r.mu.Lock()
+	now := time.Now()
+	at := r.next
+	if at.Before(now) {
+		at = now
+	}
+	r.next = at.Add(r.interval)
+	r.mu.Unlock()
+
+	time.Sleep(time.Until(at))
+	return r.s.Send(m)
+}
+
+// TeeSender sends the messages with a Sender and writes a copy of the ones
+// that were sent to an archive. It is safe for concurrent use if the
+// Sender is.
+type TeeSender struct {
+	s Sender
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewTeeSender returns a TeeSender that sends through s and writes the
+// messages sent to w. The copies are serialized again, so their Date and
+// boundaries may differ from the ones sent, and a message with a
+// BodyReader can not be copied.
+func NewTeeSender(s Sender, w io.Writer) *TeeSender {
+	return &TeeSender{s: s, w: w}
+}
+
+// Send sends m and then writes it to the archive.
+func (t *TeeSender) Send(m *Message) error {
+	if m.BodyReader != nil {
+		return errors.New("email: can not copy a BodyReader")
+	}
+	if err := t.s.Send(m); err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+	if _, err := m.WriteTo(&b); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, err := t.w.Write(b.Bytes())
+	return err
+}
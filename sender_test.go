@@ -0,0 +1,86 @@
+package email
+
+import (
+	"bytes"
+	"errors"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+type senderFunc func(m *Message) error
+
+func (f senderFunc) Send(m *Message) error {
+	return f(m)
+}
+
+func TestFallbackSender(t *testing.T) {
+	var calls []string
+	relay := func(name string, err error) Sender {
+		return senderFunc(func(m *Message) error {
+			calls = append(calls, name)
+			return err
+		})
+	}
+	temporary := &textproto.Error{Code: 451, Msg: "4.3.0 try again later"}
+	permanent := &textproto.Error{Code: 550, Msg: "5.1.1 no such user"}
+
+	for _, tt := range []struct {
+		senders FallbackSender
+		calls   string
+		err     error
+	}{
+		{FallbackSender{relay("a", nil), relay("b", nil)}, "a", nil},
+		{FallbackSender{relay("a", temporary), relay("b", nil)}, "a,b", nil},
+		{FallbackSender{relay("a", errors.New("connection refused")), relay("b", nil)}, "a,b", nil},
+		{FallbackSender{relay("a", permanent), relay("b", nil)}, "a", permanent},
+		{FallbackSender{relay("a", temporary), relay("b", temporary)}, "a,b", temporary},
+	} {
+		calls = nil
+		err := tt.senders.Send(NewMessage("Hi", "this is the body"))
+		if err != tt.err || strings.Join(calls, ",") != tt.calls {
+			t.Fatalf("got %v after %v, want %v after %s", err, calls, tt.err, tt.calls)
+		}
+	}
+	if err := (FallbackSender{}).Send(NewMessage("Hi", "")); err == nil {
+		t.Fatal("expected an error without senders")
+	}
+}
+
+func TestRateLimitedSender(t *testing.T) {
+	var times []time.Time
+	r := NewRateLimitedSender(senderFunc(func(m *Message) error {
+		times = append(times, time.Now())
+		return nil
+	}), 20*time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		if err := r.Send(NewMessage("Hi", "")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 1; i < len(times); i++ {
+		if d := times[i].Sub(times[i-1]); d < 20*time.Millisecond {
+			t.Fatalf("message %d sent %v after the previous one", i, d)
+		}
+	}
+}
+
+func TestTeeSender(t *testing.T) {
+	fail := errors.New("failed")
+	var err error
+	var archive bytes.Buffer
+	tee := NewTeeSender(senderFunc(func(m *Message) error { return err }), &archive)
+
+	if err := tee.Send(NewMessage("Sent", "")); err != nil {
+		t.Fatal(err)
+	}
+	err = fail
+	if err := tee.Send(NewMessage("Failed", "")); err != fail {
+		t.Fatalf("expected the error of the sender, got %v", err)
+	}
+	if a := archive.String(); !strings.Contains(a, "Subject: Sent\r\n") || strings.Contains(a, "Subject: Failed") {
+		t.Fatalf("unexpected archive:\n%s", a)
+	}
+}
@@ -0,0 +1,103 @@
+package email
+
+import (
+	"encoding/base64"
+	"errors"
+)
+
+// partOverhead is an estimation of the size of the boundary and headers
+// of a MIME part.
+const partOverhead = 200
+
+// ExceedsLimit reports whether the serialized message exceeds limit bytes
+// and by how much. The size is estimated from the length of the body and
+// the attachments, accounting for the base64 overhead, without
+// serializing the message. An error is returned if the size of BodyReader
+// or of an attachment Source can not be known without reading it.
+func (m *Message) ExceedsLimit(limit int64) (bool, int64, error) {
+	size, err := m.estimatedSize(true)
+	if err != nil {
+		return false, 0, err
+	}
+	if size <= limit {
+		return false, 0, nil
+	}
+	return true, size - limit, nil
+}
+
+// CurrentSize returns the estimated size of the message as composed so far,
+// computed like ExceedsLimit. It can be used to decide whether to add one
+// more attachment. A BodyReader or attachment Source of unknown size is
+// counted as empty.
+func (m *Message) CurrentSize() int64 {
+	size, _ := m.estimatedSize(false)
+	return size
+}
+
+// estimatedSize returns the estimated size of the serialized message. If
+// strict is set, an error is returned for content of unknown size,
+// otherwise that content is counted as empty.
+func (m *Message) estimatedSize(strict bool) (int64, error) {
+	size := int64(len(m.Headers()))
+
+	body := int64(len(m.Body))
+	if m.BodyReader != nil {
+		r, ok := m.BodyReader.(interface {
+			Len() int
+		})
+		switch {
+		case ok:
+			body = int64(r.Len())
+		case strict:
+			return 0, errors.New("email: unknown size of BodyReader")
+		default:
+			body = 0
+		}
+	}
+	if m.alternative() {
+		// the text alternative is never longer than the HTML
+		body = 2*body + 2*partOverhead
+	}
+	size += body + partOverhead
+
+	for _, t := range m.Translations {
+		size += 2*partOverhead + int64(len(t.Subject)+len(t.Body))
+	}
+
+	for _, attachment := range m.attachmentList() {
+		n := int64(len(attachment.Data))
+		if attachment.Source != nil {
+			src, ok := attachment.Source.(interface {
+				Size() (int64, error)
+			})
+			switch {
+			case ok:
+				var err error
+				if n, err = src.Size(); err != nil {
+					if strict {
+						return 0, err
+					}
+					n = 0
+				}
+			case strict:
+				return 0, errors.New("email: unknown size of attachment " + attachment.Filename)
+			}
+		}
+
+		size += partOverhead + int64(len(attachment.Filename))
+		if attachment.raw() {
+			size += n
+			continue
+		}
+		size += base64Size(n)
+	}
+
+	return size, nil
+}
+
+// base64Size returns the size of n bytes encoded in base64 lines of 76
+// chars.
+func base64Size(n int64) int64 {
+	enc := int64(base64.StdEncoding.EncodedLen(int(n)))
+	return enc + 2*((enc+75)/76)
+}
@@ -0,0 +1,66 @@
+package email
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestExceedsLimit(t *testing.T) {
+	m := NewMessage("Hi", "this is the body")
+	m.From = "from@example.com"
+	m.To = []string{"to@example.com"}
+	m.Attachments["big.bin"] = &Attachment{Filename: "big.bin", Data: make([]byte, 300000)}
+
+	actual := int64(len(m.Bytes()))
+
+	exceeds, over, err := m.ExceedsLimit(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exceeds || over != 0 {
+		t.Fatalf("unexpected result for a %d bytes message: %v, %d", actual, exceeds, over)
+	}
+
+	exceeds, over, err = m.ExceedsLimit(300000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exceeds {
+		t.Fatalf("a %d bytes message should exceed 300000", actual)
+	}
+	if over < actual-300000 || over > actual-300000+1000 {
+		t.Fatalf("over = %d, actual excess is %d", over, actual-300000)
+	}
+}
+
+func TestExceedsLimitBodyReader(t *testing.T) {
+	m := NewMessage("Hi", "")
+	m.BodyReader = bytes.NewReader(make([]byte, 2000))
+	if exceeds, _, err := m.ExceedsLimit(1000); err != nil || !exceeds {
+		t.Fatalf("expected to exceed the limit: %v, %v", exceeds, err)
+	}
+
+	m.BodyReader = io.MultiReader(bytes.NewReader(nil))
+	if _, _, err := m.ExceedsLimit(1000); err == nil {
+		t.Fatal("expected an error for a BodyReader of unknown size")
+	}
+}
+
+func TestCurrentSize(t *testing.T) {
+	m := NewMessage("Hi", "this is the body")
+	m.From = "from@example.com"
+	m.To = []string{"to@example.com"}
+	empty := m.CurrentSize()
+
+	m.Attachments["report.pdf"] = &Attachment{Filename: "report.pdf", Data: make([]byte, 30000)}
+	size := m.CurrentSize()
+	if size < empty+40000 || size > empty+40000+2000 {
+		t.Fatalf("unexpected size %d after attaching 30000 bytes to %d", size, empty)
+	}
+
+	m.BodyReader = io.MultiReader(bytes.NewReader(nil))
+	if s := m.CurrentSize(); s >= size {
+		t.Fatalf("a BodyReader of unknown size should count as empty: %d", s)
+	}
+}
@@ -0,0 +1,825 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Timeouts are the maximum durations of the phases of an SMTP conversation.
+type Timeouts struct {
+	Dial     time.Duration // connection and server greeting
+	Hello    time.Duration // EHLO and QUIT
+	StartTLS time.Duration
+	Auth     time.Duration
+	Data     time.Duration // MAIL, RCPT and DATA of each message
+}
+
+// DefaultTimeouts are used for the zero fields of Client.Timeouts.
+var DefaultTimeouts = Timeouts{
+	Dial:     30 * time.Second,
+	Hello:    30 * time.Second,
+	StartTLS: 30 * time.Second,
+	Auth:     30 * time.Second,
+	Data:     10 * time.Minute,
+}
+
+// Client sends messages through an SMTP server. The connection is opened
+// by the first Send and reused by the following ones until Close is called.
+type Client struct {
+	Addr       string
+	Auth       smtp.Auth
+	SkipVerify bool
+
+	// DisableTLS skips STARTTLS even when the server offers it. It is meant
+	// for trusted local relays. The auth mechanisms still apply their own
+	// checks, so PlainAuth refuses to send credentials in cleartext to a
+	// host that is not localhost.
+	DisableTLS bool
+
+	// ServerName, if set, is the host name the certificate of the server
+	// is verified against, also used for the DANE records and by the auth
+	// mechanisms, instead of the host of Addr. It allows connecting by IP
+	// address, for example to a load balancer, to a server with a
+	// certificate for its name.
+	ServerName string
+
+	// DANE verifies the certificate of the server against the TLSA
+	// records of the relay host and port (RFC 7672). If there are records
+	// the connection fails unless TLS is used and the certificate matches;
+	// if there are none the usual verification applies.
+	DANE bool
+	// LookupTLSA gets the TLSA records with DANE. It defaults to the
+	// package LookupTLSA.
+	LookupTLSA func(name string) ([]TLSA, error)
+
+	// MailParams and RcptParams are added to the MAIL FROM and RCPT TO
+	// commands as KEY=VALUE parameters, or just KEY if the value is empty.
+	// They allow using extensions not supported by this package, but the
+	// server rejects the commands with parameters it does not understand,
+	// so only use the extensions that it advertises.
+	MailParams map[string]string
+	RcptParams map[string]string
+
+	// LocalAddr, if set, is the local address used to connect, to choose
+	// the source IP on hosts with several.
+	LocalAddr net.Addr
+
+	// Compress compresses the connection with DEFLATE when the server
+	// advertises COMPRESS DEFLATE, for metered links. It is not used over
+	// TLS, as compressing before encrypting can leak the content, like in
+	// the CRIME attack, so it is only meant for trusted links with
+	// DisableTLS or servers without STARTTLS.
+	Compress bool
+
+	// ProxyProtocol, if 1 or 2, is the version of the PROXY protocol
+	// header sent before the SMTP conversation, for servers behind a
+	// proxy like HAProxy that expect it to know the address of the
+	// client. The addresses are the ones of the connection.
+	ProxyProtocol int
+
+	// FallbackDelay is how long to wait for a connection to the first
+	// address family of a host with IPv6 and IPv4 addresses before also
+	// trying the other one. It defaults to 300ms.
+	FallbackDelay time.Duration
+
+	// Idempotency, if set, is used to skip the messages with an
+	// IdempotencyKey that was already sent. This is a best effort
+	// deduplication for job systems that may submit a message twice.
+	Idempotency IdempotencyStore
+
+	// SenderFromAuth sends the messages whose From is not the
+	// authenticated user, which relays like Gmail may reject, with that
+	// user in the Sender header and as the envelope sender. The user is
+	// derived from PlainAuth, LoginAuth and CRAMMD5Auth when it is an
+	// address; with other mechanisms or usernames the messages are sent
+	// unchanged.
+	SenderFromAuth bool
+
+	// IsolateBcc sends a separate copy of the messages to each Bcc
+	// recipient, so their addresses are never in the same transaction as
+	// the other recipients. If a copy fails, the previous ones were
+	// already sent.
+	IsolateBcc bool
+
+	// MaxRecipients, if not zero, is the maximum number of recipients of
+	// a message. Send fails with ErrTooManyRecipients before connecting
+	// if a message has more, see SendBatched.
+	MaxRecipients int
+
+	// Preflight runs the transactions up to the recipients and then
+	// aborts them with RSET instead of sending the messages, so a Send
+	// succeeds if the server would accept them. It is meant to check the
+	// configuration and the recipients, for example in staging.
+	Preflight bool
+
+	// OnProgress, if set, is called as the data of the messages is sent
+	// with the bytes written so far and the size of the message, at least
+	// once per 32 KiB and once at the end. The size is the estimation of
+	// CurrentSize, as the message is not written twice, so the bytes
+	// written at the end may differ from it slightly.
+	OnProgress func(bytesWritten, totalBytes int64)
+
+	// Timeouts of each phase of the conversation. Zero fields use the
+	// value in DefaultTimeouts.
+	Timeouts Timeouts
+
+	c      *smtp.Client
+	conn   net.Conn
+	banner string
+}
+
+// ErrTooManyRecipients is returned when a message has more recipients
+// than Client.MaxRecipients.
+var ErrTooManyRecipients = errors.New("email: too many recipients")
+
+// NewClient returns a Client for the SMTP server at addr.
+// skipverify disables the TLS cert validation (insecure).
+func NewClient(addr string, auth smtp.Auth, skipverify bool) *Client {
+	return &Client{Addr: addr, Auth: auth, SkipVerify: skipverify}
+}
+
+// connect dials the SMTP server if not connected yet, upgrades the
+// connection with STARTTLS when the server supports it and authenticates
+// if Auth is not nil.
+func (c *Client) connect() error {
+	if c.c != nil {
+		return nil
+	}
+	t := c.timeouts()
+	conn, err := c.dial(t.Dial)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(t.Dial))
+	if c.ProxyProtocol != 0 {
+		h, err := proxyHeader(c.ProxyProtocol, conn.LocalAddr(), conn.RemoteAddr())
+		if err == nil {
+			_, err = conn.Write(h)
+		}
+		if err != nil {
+			conn.Close()
+			return err
+		}
+	}
+	host, port, _ := net.SplitHostPort(c.Addr)
+	name := c.serverName()
+	rc := &recordConn{Conn: conn}
+	sc, err := smtp.NewClient(rc, name)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	c.banner = rc.stop()
+	conn.SetDeadline(time.Now().Add(t.Hello))
+	if err = sc.Hello(host); err != nil {
+		sc.Close()
+		return err
+	}
+	var tlsa []TLSA
+	if c.DANE {
+		lookup := c.LookupTLSA
+		if lookup == nil {
+			lookup = LookupTLSA
+		}
+		if tlsa, err = lookup("_" + port + "._tcp." + name); err != nil {
+			sc.Close()
+			return err
+		}
+	}
+	if ok, _ := sc.Extension("STARTTLS"); ok && !c.DisableTLS {
+		conn.SetDeadline(time.Now().Add(t.StartTLS))
+		config := &tls.Config{ServerName: name, InsecureSkipVerify: c.SkipVerify}
+		if len(tlsa) > 0 {
+			config.InsecureSkipVerify = true
+			config.VerifyConnection = func(cs tls.ConnectionState) error {
+				return verifyTLSA(tlsa, cs, name)
+			}
+		}
+		if err = sc.StartTLS(config); err != nil {
+			sc.Close()
+			return fmt.Errorf("email: STARTTLS negotiation failed with %s: %w", name, err)
+		}
+	} else if len(tlsa) > 0 {
+		sc.Close()
+		return fmt.Errorf("email: %s has TLSA records but does not use TLS", name)
+	}
+	if c.Auth != nil {
+		if ok, _ := sc.Extension("AUTH"); ok {
+			conn.SetDeadline(time.Now().Add(t.Auth))
+			if err = sc.Auth(c.Auth); err != nil {
+				sc.Close()
+				return err
+			}
+		}
+	}
+	if _, secure := sc.TLSConnectionState(); c.Compress && !secure && deflateAdvertised(sc) {
+		conn.SetDeadline(time.Now().Add(t.Hello))
+		if _, _, err = cmd(sc.Text, 2, "COMPRESS DEFLATE"); err != nil {
+			sc.Close()
+			return err
+		}
+		sc.Text = textproto.NewConn(newDeflateConn(conn))
+	}
+	conn.SetDeadline(time.Time{})
+	c.c, c.conn = sc, conn
+	return nil
+}
+
+// deflateAdvertised reports whether the server advertises COMPRESS with
+// the DEFLATE algorithm.
+func deflateAdvertised(sc *smtp.Client) bool {
+	ok, params := sc.Extension("COMPRESS")
+	if !ok {
+		return false
+	}
+	for _, p := range strings.Fields(params) {
+		if strings.EqualFold(p, "DEFLATE") {
+			return true
+		}
+	}
+	return false
+}
+
+// Banner returns the greeting of the server in the current connection,
+// without the 220 code, which often identifies its software. The lines of
+// a multiline greeting are separated by "\n". It is empty if the Client is
+// not connected.
+func (c *Client) Banner() string {
+	if c.c == nil {
+		return ""
+	}
+	return c.banner
+}
+
+// TLSConnectionState returns the state of the TLS session of the current
+// connection. ok is false if the Client is not connected or the
+// connection is not encrypted.
+func (c *Client) TLSConnectionState() (state tls.ConnectionState, ok bool) {
+	if c.c == nil {
+		return tls.ConnectionState{}, false
+	}
+	return c.c.TLSConnectionState()
+}
+
+// progressChunk is the maximum number of bytes written between two calls
+// to OnProgress.
+const progressChunk = 32 << 10
+
+// progressWriter writes to w in chunks of progressChunk, calling f after
+// each one.
+type progressWriter struct {
+	w        io.Writer
+	n, total int64
+	f        func(bytesWritten, totalBytes int64)
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > progressChunk {
+			chunk = chunk[:progressChunk]
+		}
+		n, err := w.w.Write(chunk)
+		written += n
+		w.n += int64(n)
+		if n > 0 {
+			w.f(w.n, w.total)
+		}
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// recordConn records the data read from a connection until stop is called,
+// to get the greeting read by smtp.NewClient.
+type recordConn struct {
+	net.Conn
+	buf     bytes.Buffer
+	stopped bool
+}
+
+func (c *recordConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if !c.stopped {
+		c.buf.Write(p[:n])
+	}
+	return n, err
+}
+
+// stop stops recording and returns the text of the reply read.
+func (c *recordConn) stop() string {
+	c.stopped = true
+	_, msg, _ := textproto.NewReader(bufio.NewReader(&c.buf)).ReadResponse(220)
+	c.buf = bytes.Buffer{}
+	return msg
+}
+
+// serverName returns ServerName or else the host of Addr.
+func (c *Client) serverName() string {
+	if c.ServerName != "" {
+		return c.ServerName
+	}
+	host, _, _ := net.SplitHostPort(c.Addr)
+	return host
+}
+
+// Capabilities returns the extensions advertised by the server in its
+// response to EHLO, like "SIZE" or "AUTH", mapped to their parameters, like
+// "35882577" or "PLAIN LOGIN". It connects to the server if needed and
+// sends a new EHLO, so it must not be called while sending a message.
+func (c *Client) Capabilities() (map[string]string, error) {
+	if err := c.connect(); err != nil {
+		return nil, err
+	}
+	c.conn.SetDeadline(time.Now().Add(c.timeouts().Hello))
+	defer c.conn.SetDeadline(time.Time{})
+
+	host, _, _ := net.SplitHostPort(c.Addr)
+	_, msg, err := cmd(c.c.Text, 250, "EHLO %s", host)
+	if err != nil {
+		return nil, err
+	}
+	caps := make(map[string]string)
+	// the first line is the domain of the server
+	lines := strings.Split(msg, "\n")
+	for _, line := range lines[1:] {
+		kv := strings.SplitN(line, " ", 2)
+		if len(kv) == 1 {
+			kv = append(kv, "")
+		}
+		caps[strings.ToUpper(kv[0])] = kv[1]
+	}
+	return caps, nil
+}
+
+// timeouts returns c.Timeouts with the zero fields set to the defaults.
+func (c *Client) timeouts() Timeouts {
+	t := c.Timeouts
+	if t.Dial == 0 {
+		t.Dial = DefaultTimeouts.Dial
+	}
+	if t.Hello == 0 {
+		t.Hello = DefaultTimeouts.Hello
+	}
+	if t.StartTLS == 0 {
+		t.StartTLS = DefaultTimeouts.StartTLS
+	}
+	if t.Auth == 0 {
+		t.Auth = DefaultTimeouts.Auth
+	}
+	if t.Data == 0 {
+		t.Data = DefaultTimeouts.Data
+	}
+	return t
+}
+
+// Result is the outcome of a message sent by a Client.
+type Result struct {
+	// Response is the text of the final response of the server to the
+	// message data, like "2.0.0 Ok: queued as 4F1A2".
+	Response string
+	// QueueID is the queue identifier of the message in the server, parsed
+	// from Response. It is empty if the format of Response is unknown.
+	QueueID string
+	// Skipped is true if the message was not sent because its
+	// IdempotencyKey was already sent.
+	Skipped bool
+	// TLS is the state of the TLS session the message was sent over, with
+	// the version, the cipher suite and the certificates of the server. It
+	// is nil if the connection was not encrypted.
+	TLS *tls.ConnectionState
+}
+
+var queueIDRe = regexp.MustCompile(`(?i)(?:queued as|\bid=)\s*([A-Za-z0-9._-]+)`)
+
+// Send sends m, connecting to the server first if needed. If m has an
+// IdempotencyKey that was already sent, it is skipped and nil is returned.
+func (c *Client) Send(m *Message) error {
+	_, err := c.SendResult(m)
+	return err
+}
+
+// SendResult is like Send but also returns the response of the server.
+func (c *Client) SendResult(m *Message) (*Result, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	if n := len(m.Tolist()); c.MaxRecipients > 0 && n > c.MaxRecipients {
+		return nil, fmt.Errorf("%w: %d, the limit is %d", ErrTooManyRecipients, n, c.MaxRecipients)
+	}
+	dedup := c.Idempotency != nil && m.IdempotencyKey != "" && !c.Preflight
+	if dedup {
+		if seen, err := c.Idempotency.Seen(m.IdempotencyKey); err != nil || seen {
+			return &Result{Skipped: seen}, err
+		}
+	}
+	r, err := c.do(func() (*Result, error) { return c.send(m) })
+	if err != nil {
+		return nil, err
+	}
+	if dedup {
+		return r, c.Idempotency.Add(m.IdempotencyKey)
+	}
+	return r, nil
+}
+
+func (c *Client) send(m *Message) (*Result, error) {
+	// the copies of m changed for the server hold references to its
+	// spooled attachments, released when they are replaced or sent
+	orig := m
+	use := func(next *Message) {
+		if m != orig {
+			m.RemoveSpooled()
+		}
+		m = next
+	}
+	defer use(nil)
+
+	from := m.envelopeSender()
+	if c.SenderFromAuth && !m.NullSender {
+		addr := m.From
+		if a, err := mail.ParseAddress(m.From); err == nil {
+			addr = a.Address
+		}
+		if user := authIdentity(c.Auth, c.serverName()); user != "" && !strings.EqualFold(user, addr) {
+			if m.DKIMSignature != "" {
+				return nil, errors.New("email: can not add the Sender header to a signed message")
+			}
+			use(m.Clone())
+			m.Sender = user
+			from = user
+		}
+	}
+	if ok, _ := c.c.Extension("8BITMIME"); !ok && m.BodyEncoding == "" && m.needs8BitMIME() {
+		if m.DKIMSignature != "" {
+			return nil, errors.New("email: the server does not support 8BITMIME, required by the signed message")
+		}
+		use(m.Clone())
+		m.BodyEncoding = "quoted-printable"
+	}
+	if ok, _ := c.c.Extension("SMTPUTF8"); !ok {
+		downgraded, err := m.downgradeHeaders()
+		if err != nil {
+			return nil, err
+		}
+		if downgraded != m && m.DKIMSignature != "" {
+			return nil, errors.New("email: the server does not support SMTPUTF8, required by the signed message")
+		}
+		if downgraded != m {
+			use(downgraded)
+		}
+	}
+	write := func(w io.Writer) error {
+		if c.OnProgress != nil {
+			// the message is written once, so its size is estimated
+			w = &progressWriter{w: w, total: m.CurrentSize(), f: c.OnProgress}
+		}
+		_, err := m.WriteTo(w)
+		return err
+	}
+	if !c.IsolateBcc || len(m.Bcc) == 0 {
+		return c.transaction(from, m.Tolist(), m.OriginalRecipients, m.RequireTLS, write)
+	}
+
+	if m.BodyReader != nil {
+		return nil, errors.New("email: can not send a BodyReader more than once")
+	}
+	var groups [][]string
+	if public := append(append([]string(nil), m.To...), m.Cc...); len(public) > 0 {
+		groups = append(groups, public)
+	}
+	for _, bcc := range m.Bcc {
+		groups = append(groups, []string{bcc})
+	}
+	var r *Result
+	for i, rcpts := range groups {
+		var err error
+		if r, err = c.transaction(from, rcpts, m.OriginalRecipients, m.RequireTLS, write); err != nil {
+			var closed *connClosedError
+			if i > 0 && errors.As(err, &closed) {
+				// do not send again to the previous groups
+				err = closed.err
+			}
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// SendRaw sends raw, an already serialized message, from the from address
+// to the to addresses, connecting to the server first if needed. raw is
+// sent as is, so it must be a valid message, like one signed by another
+// system.
+func (c *Client) SendRaw(from string, to []string, raw []byte) error {
+	if from == "" {
+		return ErrMissingFrom
+	}
+	if len(to) == 0 {
+		return errors.New("email: at least one recipient is required")
+	}
+	for _, addr := range append([]string{from}, to...) {
+		if strings.ContainsAny(addr, "\r\n") {
+			return errors.New("email: an address must not contain CR or LF")
+		}
+	}
+	_, err := c.do(func() (*Result, error) {
+		return c.transaction(from, to, nil, false, func(w io.Writer) error {
+			if c.OnProgress != nil {
+				w = &progressWriter{w: w, total: int64(len(raw)), f: c.OnProgress}
+			}
+			_, err := w.Write(raw)
+			return err
+		})
+	})
+	return err
+}
+
+// do connects if needed and runs the mail transaction f. If the server
+// closed a reused connection, which relays do with idle connections, f is
+// run once more on a new connection.
+func (c *Client) do(f func() (*Result, error)) (*Result, error) {
+	for attempt := 0; ; attempt++ {
+		reused := c.c != nil
+		if err := c.connect(); err != nil {
+			return nil, err
+		}
+		r, err := f()
+		var closed *connClosedError
+		if errors.As(err, &closed) {
+			c.c.Close()
+			c.c = nil
+			if reused && attempt == 0 {
+				continue
+			}
+			return nil, closed.err
+		}
+		if err != nil && c.c != nil {
+			c.reset()
+		}
+		return r, err
+	}
+}
+
+// authIdentity returns the address of the user authenticated by auth, or
+// "" if it is not known.
+func authIdentity(auth smtp.Auth, host string) string {
+	var user string
+	if a, ok := auth.(*loginAuth); ok {
+		user = a.username
+	} else if auth != nil {
+		server := &smtp.ServerInfo{Name: host, TLS: true, Auth: []string{"PLAIN", "CRAM-MD5"}}
+		proto, resp, err := auth.Start(server)
+		if err != nil {
+			return ""
+		}
+		switch proto {
+		case "PLAIN":
+			// identity, username and password separated by NUL
+			if f := strings.Split(string(resp), "\x00"); len(f) == 3 {
+				user = f[1]
+			}
+		case "CRAM-MD5":
+			// username and digest of the challenge separated by a space
+			if resp, err := auth.Next([]byte("<0@localhost>"), true); err == nil {
+				user = strings.SplitN(string(resp), " ", 2)[0]
+			}
+		}
+	}
+	if _, err := mail.ParseAddress(user); err != nil {
+		return ""
+	}
+	return user
+}
+
+// connClosedError is returned by transaction if the connection was closed
+// before the message data was sent, so it is safe to send it again.
+type connClosedError struct {
+	err error
+}
+
+func (e *connClosedError) Error() string {
+	return e.err.Error()
+}
+
+// checkClosed returns err as a connClosedError if it is caused by a
+// connection closed by the server.
+func checkClosed(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET) {
+		return &connClosedError{err}
+	}
+	return err
+}
+
+// transaction sends the MAIL, RCPT and DATA commands, with the data
+// written by data. orcpt are the original recipients sent with DSN.
+// requireTLS adds the REQUIRETLS parameter, and fails if the connection is
+// not encrypted or the server does not support it.
+func (c *Client) transaction(from string, rcpts []string, orcpt map[string]string, requireTLS bool, data func(io.Writer) error) (*Result, error) {
+	mailParams, err := formatParams(c.MailParams)
+	if err != nil {
+		return nil, err
+	}
+	rcptParams, err := formatParams(c.RcptParams)
+	if err != nil {
+		return nil, err
+	}
+
+	if requireTLS {
+		if _, ok := c.c.TLSConnectionState(); !ok {
+			return nil, errors.New("email: REQUIRETLS needs a TLS connection")
+		}
+		if ok, _ := c.c.Extension("REQUIRETLS"); !ok {
+			return nil, errors.New("email: the server does not support REQUIRETLS")
+		}
+		mailParams = " REQUIRETLS" + mailParams
+	}
+	smtputf8, _ := c.c.Extension("SMTPUTF8")
+	envelopeFrom, err := envelopeAddress(from, smtputf8)
+	if err != nil {
+		return nil, err
+	}
+	envelopeTo := make([]string, len(rcpts))
+	for i, to := range rcpts {
+		if envelopeTo[i], err = envelopeAddress(to, smtputf8); err != nil {
+			return nil, err
+		}
+	}
+
+	c.conn.SetDeadline(time.Now().Add(c.timeouts().Data))
+	defer c.conn.SetDeadline(time.Time{})
+
+	tp := c.c.Text
+	if ok, _ := c.c.Extension("8BITMIME"); ok {
+		mailParams = " BODY=8BITMIME" + mailParams
+	}
+	if smtputf8 {
+		mailParams = " SMTPUTF8" + mailParams
+	}
+	if _, _, err := cmd(tp, 250, "MAIL FROM:<%s>%s", envelopeFrom, mailParams); err != nil {
+		return nil, checkClosed(err)
+	}
+	dsn, _ := c.c.Extension("DSN")
+	for i, to := range rcpts {
+		params := rcptParams
+		if orig, ok := orcpt[to]; ok && dsn {
+			params = " ORCPT=rfc822;" + xtext(orig) + params
+		}
+		if _, _, err := cmd(tp, 25, "RCPT TO:<%s>%s", envelopeTo[i], params); err != nil {
+			return nil, checkClosed(err)
+		}
+	}
+	if c.Preflight {
+		c.reset()
+		return &Result{}, nil
+	}
+	if _, _, err := cmd(tp, 354, "DATA"); err != nil {
+		return nil, checkClosed(err)
+	}
+	w := tp.DotWriter()
+	if err := data(w); err != nil {
+		// the only way to abort DATA is to drop the connection before
+		// the final dot, so the server discards the partial message
+		c.c.Close()
+		c.c = nil
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	_, msg, err := tp.ReadResponse(250)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Result{Response: msg}
+	if state, ok := c.c.TLSConnectionState(); ok {
+		r.TLS = &state
+	}
+	if match := queueIDRe.FindStringSubmatch(msg); match != nil {
+		r.QueueID = match[1]
+	}
+	return r, nil
+}
+
+// formatParams returns the MAIL or RCPT parameters as " KEY=VALUE" pairs
+// sorted by key. It fails if a key or a value is not valid (RFC 5321).
+func formatParams(params map[string]string) (string, error) {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var s string
+	for _, k := range keys {
+		v := params[k]
+		for i, r := range k {
+			if !(r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' && i > 0) {
+				return "", fmt.Errorf("email: invalid parameter %q", k)
+			}
+		}
+		if k == "" {
+			return "", errors.New("email: empty parameter")
+		}
+		for _, r := range v {
+			if r < 33 || r > 126 || r == '=' {
+				return "", fmt.Errorf("email: invalid value of parameter %s: %q", k, v)
+			}
+		}
+		s += " " + k
+		if v != "" {
+			s += "=" + v
+		}
+	}
+	return s, nil
+}
+
+// cmd sends a command and reads the response, like the unexported method
+// of smtp.Client.
+func cmd(tp *textproto.Conn, expectCode int, format string, args ...interface{}) (int, string, error) {
+	id, err := tp.Cmd(format, args...)
+	if err != nil {
+		return 0, "", err
+	}
+	tp.StartResponse(id)
+	defer tp.EndResponse(id)
+	return tp.ReadResponse(expectCode)
+}
+
+// reset aborts the current mail transaction. The connection is dropped if
+// the server does not accept the RSET.
+func (c *Client) reset() {
+	c.conn.SetDeadline(time.Now().Add(c.timeouts().Hello))
+	defer c.conn.SetDeadline(time.Time{})
+
+	if err := c.c.Reset(); err != nil {
+		c.c.Close()
+		c.c = nil
+	}
+}
+
+// Close sends the QUIT command and closes the connection to the server.
+func (c *Client) Close() error {
+	if c.c == nil {
+		return nil
+	}
+	c.conn.SetDeadline(time.Now().Add(c.timeouts().Hello))
+	err := c.c.Quit()
+	if err != nil {
+		c.c.Close()
+	}
+	c.c = nil
+	return err
+}
+
+// VerifyConnection checks that the SMTP server at addr is reachable and
+// accepts auth without sending any message.
+func VerifyConnection(addr string, auth smtp.Auth, skipverify bool) error {
+	c := NewClient(addr, auth, skipverify)
+	if err := c.connect(); err != nil {
+		return err
+	}
+	return c.Close()
+}
+
+// Added skipverify parameter in order to skip TLS cert validation (insecure).
+// The temporary files of the attachments added with AttachReader are
+// released once the message is sent or fails, as with RemoveSpooled.
+func Send(addr string, auth smtp.Auth, m *Message, skipverify bool) error {
+	defer m.RemoveSpooled()
+	c := NewClient(addr, auth, skipverify)
+	if err := c.Send(m); err != nil {
+		c.Close()
+		return err
+	}
+	return c.Close()
+}
+
+// SendRaw sends raw, an already serialized message, through the SMTP
+// server at addr. See Client.SendRaw.
+func SendRaw(addr string, auth smtp.Auth, from string, to []string, raw []byte, skipverify bool) error {
+	c := NewClient(addr, auth, skipverify)
+	if err := c.SendRaw(from, to, raw); err != nil {
+		c.Close()
+		return err
+	}
+	return c.Close()
+}
@@ -0,0 +1,909 @@
+package email
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// testServer is a minimal SMTP server that records the commands and
+// messages it receives.
+type testServer struct {
+	ln         net.Listener
+	extensions []string
+
+	// reply, if set, is consulted before the default handling of each
+	// command. Returning an empty string falls back to the default reply.
+	reply func(cmd string) string
+
+	// lmtp, if set, makes the server reply to DATA with one response per
+	// recipient, as returned by lmtp.
+	lmtp func(rcpt string) string
+
+	// stall, if set, makes the server stop responding when it returns
+	// true. It is called with an empty command before the greeting.
+	stall func(cmd string) bool
+
+	// drop, if set, makes the server close the connection when it returns
+	// true.
+	drop func(cmd string) bool
+
+	// proxy, if set, reads the PROXY protocol header before the
+	// greeting. The connection is closed if it fails.
+	proxy func(conn net.Conn) error
+
+	// banner, if set, replaces the greeting.
+	banner string
+
+	// tlsConfig, if set, is used to accept STARTTLS.
+	tlsConfig *tls.Config
+
+	start sync.Once
+
+	mu      sync.Mutex
+	cmds    []string
+	msgs    []string
+	remotes []net.Addr
+}
+
+// newTestServer returns a testServer advertising extensions. It starts
+// accepting connections on the first call to Addr, so it must be
+// configured before.
+func newTestServer(t *testing.T, extensions ...string) *testServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testServer{ln: ln, extensions: extensions}
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *testServer) Addr() string {
+	s.start.Do(func() {
+		go func() {
+			for {
+				conn, err := s.ln.Accept()
+				if err != nil {
+					return
+				}
+				go s.serve(conn)
+			}
+		}()
+	})
+	return s.ln.Addr().String()
+}
+
+func (s *testServer) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.cmds...)
+}
+
+func (s *testServer) Messages() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.msgs...)
+}
+
+func (s *testServer) serve(conn net.Conn) {
+	defer conn.Close()
+	s.mu.Lock()
+	s.remotes = append(s.remotes, conn.RemoteAddr())
+	s.mu.Unlock()
+	if s.proxy != nil && s.proxy(conn) != nil {
+		return
+	}
+	tp := textproto.NewConn(conn)
+	if s.stall != nil && s.stall("") {
+		io.Copy(ioutil.Discard, conn)
+		return
+	}
+	if s.banner != "" {
+		tp.PrintfLine("%s", s.banner)
+	} else {
+		tp.PrintfLine("220 localhost ESMTP test")
+	}
+	var rcpts []string
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.cmds = append(s.cmds, line)
+		s.mu.Unlock()
+
+		if s.stall != nil && s.stall(line) {
+			io.Copy(ioutil.Discard, conn)
+			return
+		}
+		if s.drop != nil && s.drop(line) {
+			return
+		}
+		if s.reply != nil {
+			if r := s.reply(line); r != "" {
+				tp.PrintfLine("%s", r)
+				continue
+			}
+		}
+
+		verb := strings.ToUpper(strings.Fields(line + " ")[0])
+		switch verb {
+		case "EHLO", "LHLO":
+			lines := append([]string{"localhost"}, s.extensions...)
+			for i, l := range lines {
+				sep := "-"
+				if i == len(lines)-1 {
+					sep = " "
+				}
+				tp.PrintfLine("250%s%s", sep, l)
+			}
+		case "STARTTLS":
+			if s.tlsConfig == nil {
+				tp.PrintfLine("454 4.7.0 TLS not available")
+				continue
+			}
+			tp.PrintfLine("220 2.0.0 Ready to start TLS")
+			tc := tls.Server(conn, s.tlsConfig)
+			if err := tc.Handshake(); err != nil {
+				return
+			}
+			conn, tp = tc, textproto.NewConn(tc)
+		case "COMPRESS":
+			tp.PrintfLine("250 2.0.0 Compression active")
+			dc := newDeflateConn(conn)
+			conn, tp = dc, textproto.NewConn(dc)
+		case "AUTH":
+			tp.PrintfLine("235 2.7.0 Authentication successful")
+		case "DATA":
+			tp.PrintfLine("354 Go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.msgs = append(s.msgs, string(data))
+			s.mu.Unlock()
+			if s.lmtp != nil {
+				for _, rcpt := range rcpts {
+					tp.PrintfLine("%s", s.lmtp(rcpt))
+				}
+				continue
+			}
+			tp.PrintfLine("250 2.0.0 Ok: queued as 4F1A2")
+		case "MAIL", "RSET":
+			rcpts = nil
+			tp.PrintfLine("250 2.0.0 Ok")
+		case "RCPT":
+			rcpts = append(rcpts, line[len("RCPT TO:"):])
+			tp.PrintfLine("250 2.1.5 Ok")
+		case "QUIT":
+			tp.PrintfLine("221 2.0.0 Bye")
+			return
+		default:
+			tp.PrintfLine("250 2.0.0 Ok")
+		}
+	}
+}
+
+// testCertificate returns a self-signed certificate for hosts.
+func testCertificate(t *testing.T, hosts ...string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: hosts[0]},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}
+}
+
+func TestVerifyConnection(t *testing.T) {
+	s := newTestServer(t, "AUTH PLAIN")
+
+	auth := smtp.PlainAuth("", "user", "password", "127.0.0.1")
+	if err := VerifyConnection(s.Addr(), auth, false); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cmd := range s.Commands() {
+		if strings.HasPrefix(cmd, "MAIL") || strings.HasPrefix(cmd, "DATA") {
+			t.Fatalf("unexpected command %q", cmd)
+		}
+	}
+	cmds := s.Commands()
+	if !strings.HasPrefix(cmds[1], "AUTH PLAIN") || cmds[len(cmds)-1] != "QUIT" {
+		t.Fatalf("unexpected conversation: %v", cmds)
+	}
+}
+
+func TestVerifyConnectionAuthFailure(t *testing.T) {
+	s := newTestServer(t, "AUTH PLAIN")
+	s.reply = func(cmd string) string {
+		if strings.HasPrefix(cmd, "AUTH") {
+			return "535 5.7.8 Authentication failed"
+		}
+		return ""
+	}
+
+	auth := smtp.PlainAuth("", "user", "password", "127.0.0.1")
+	if err := VerifyConnection(s.Addr(), auth, false); err == nil {
+		t.Fatal("expected an authentication error")
+	}
+}
+
+func TestClientDisableTLS(t *testing.T) {
+	s := newTestServer(t, "STARTTLS")
+
+	m := NewMessage("Hi", "this is the body")
+	m.From = "from@example.com"
+	m.To = []string{"to@example.com"}
+
+	c := NewClient(s.Addr(), nil, false)
+	c.DisableTLS = true
+	if err := c.Send(m); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cmd := range s.Commands() {
+		if cmd == "STARTTLS" {
+			t.Fatal("STARTTLS sent with DisableTLS")
+		}
+	}
+	if len(s.Messages()) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(s.Messages()))
+	}
+}
+
+func TestClientTimeouts(t *testing.T) {
+	for _, phase := range []string{"", "EHLO", "STARTTLS", "AUTH", "MAIL", "DATA"} {
+		s := newTestServer(t, "AUTH PLAIN")
+		if phase == "STARTTLS" {
+			s.extensions = append(s.extensions, "STARTTLS")
+		}
+		s.stall = func(cmd string) bool {
+			return strings.HasPrefix(cmd, phase) && (phase != "" || cmd == "")
+		}
+
+		m := NewMessage("Hi", "this is the body")
+		m.From = "from@example.com"
+		m.To = []string{"to@example.com"}
+
+		c := NewClient(s.Addr(), smtp.PlainAuth("", "user", "password", "127.0.0.1"), true)
+		c.Timeouts = Timeouts{
+			Dial:     50 * time.Millisecond,
+			Hello:    50 * time.Millisecond,
+			StartTLS: 50 * time.Millisecond,
+			Auth:     50 * time.Millisecond,
+			Data:     50 * time.Millisecond,
+		}
+
+		start := time.Now()
+		err := c.Send(m)
+		c.Close()
+		var nerr net.Error
+		if !errors.As(err, &nerr) || !nerr.Timeout() {
+			t.Fatalf("phase %q: expected a timeout, got %v", phase, err)
+		}
+		if d := time.Since(start); d > time.Second {
+			t.Fatalf("phase %q: timed out after %v", phase, d)
+		}
+	}
+}
+
+func TestClientParams(t *testing.T) {
+	s := newTestServer(t, "8BITMIME")
+
+	m := NewMessage("Hi", "this is the body")
+	m.From = "from@example.com"
+	m.To = []string{"to@example.com"}
+
+	c := NewClient(s.Addr(), nil, false)
+	defer c.Close()
+	c.MailParams = map[string]string{"X-VENDOR": "1", "ENVID": "abc"}
+	c.RcptParams = map[string]string{"X-FLAG": ""}
+	if err := c.Send(m); err != nil {
+		t.Fatal(err)
+	}
+
+	cmds := strings.Join(s.Commands(), "\n")
+	if !strings.Contains(cmds, "MAIL FROM:<from@example.com> BODY=8BITMIME ENVID=abc X-VENDOR=1\n") ||
+		!strings.Contains(cmds, "RCPT TO:<to@example.com> X-FLAG\n") {
+		t.Fatalf("unexpected commands:\n%s", cmds)
+	}
+
+	for _, params := range []map[string]string{
+		{"BAD KEY": "1"},
+		{"KEY": "a b"},
+		{"KEY": "a=b"},
+		{"": "1"},
+	} {
+		c.MailParams = params
+		if err := c.Send(m); err == nil {
+			t.Fatalf("expected an error for %v", params)
+		}
+	}
+}
+
+func TestClientLocalAddr(t *testing.T) {
+	s := newTestServer(t)
+
+	c := NewClient(s.Addr(), nil, false)
+	c.LocalAddr = &net.TCPAddr{IP: net.ParseIP("127.0.0.2")}
+	if err := VerifyConnection(s.Addr(), nil, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.connect(); err != nil {
+		t.Skipf("can not bind to 127.0.0.2: %v", err)
+	}
+	c.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ip := s.remotes[1].(*net.TCPAddr).IP.String(); ip != "127.0.0.2" {
+		t.Fatalf("connection from %s", ip)
+	}
+	if ip := s.remotes[0].(*net.TCPAddr).IP.String(); ip != "127.0.0.1" {
+		t.Fatalf("default connection from %s", ip)
+	}
+}
+
+func TestClientSendResult(t *testing.T) {
+	s := newTestServer(t)
+
+	m := NewMessage("Hi", "this is the body")
+	m.From = "from@example.com"
+	m.To = []string{"to@example.com"}
+
+	c := NewClient(s.Addr(), nil, false)
+	defer c.Close()
+	r, err := c.SendResult(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Response != "2.0.0 Ok: queued as 4F1A2" || r.QueueID != "4F1A2" {
+		t.Fatalf("unexpected result: %+v", r)
+	}
+
+	for resp, id := range map[string]string{
+		"OK id=1pQxYz-0003Ab-C1": "1pQxYz-0003Ab-C1",
+		"2.0.0 Ok":               "",
+	} {
+		if match := queueIDRe.FindStringSubmatch(resp); match != nil && match[1] != id || match == nil && id != "" {
+			t.Fatalf("queue id of %q: got %v, want %q", resp, match, id)
+		}
+	}
+}
+
+func TestLoginAuth(t *testing.T) {
+	const username, password = "usér@example.com", "p+ss/wörd=="
+
+	s := newTestServer(t, "AUTH LOGIN")
+	var step int
+	var got []string
+	s.reply = func(cmd string) string {
+		switch {
+		case cmd == "AUTH LOGIN":
+			step = 1
+			return "334 " + base64.StdEncoding.EncodeToString([]byte("Username:"))
+		case step == 1:
+			step = 2
+			got = append(got, cmd)
+			return "334 " + base64.StdEncoding.EncodeToString([]byte("Password:"))
+		case step == 2:
+			step = 0
+			got = append(got, cmd)
+			return "235 2.7.0 Authentication successful"
+		}
+		return ""
+	}
+
+	if err := VerifyConnection(s.Addr(), LoginAuth(username, password, "127.0.0.1"), false); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{username, password} {
+		if dec, err := base64.StdEncoding.DecodeString(got[i]); err != nil || string(dec) != want {
+			t.Fatalf("response %d: got %q, want %q", i, got[i], want)
+		}
+	}
+}
+
+func TestClientCapabilities(t *testing.T) {
+	s := newTestServer(t, "SIZE 35882577", "AUTH PLAIN LOGIN", "8BITMIME", "chunking")
+
+	c := NewClient(s.Addr(), nil, false)
+	defer c.Close()
+	caps, err := c.Capabilities()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"SIZE": "35882577", "AUTH": "PLAIN LOGIN", "8BITMIME": "", "CHUNKING": ""}
+	if len(caps) != len(want) {
+		t.Fatalf("got %v, want %v", caps, want)
+	}
+	for k, v := range want {
+		if got, ok := caps[k]; !ok || got != v {
+			t.Fatalf("got %v, want %v", caps, want)
+		}
+	}
+
+	m := NewMessage("Hi", "this is the body")
+	m.From = "from@example.com"
+	m.To = []string{"to@example.com"}
+	if err := c.Send(m); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSendRaw(t *testing.T) {
+	s := newTestServer(t)
+
+	raw := []byte("From: from@example.com\r\nTo: to@example.com\r\nSubject: Hi\r\n\r\n.leading dot\r\n")
+	if err := SendRaw(s.Addr(), nil, "from@example.com", []string{"to@example.com", "bcc@example.com"}, raw, false); err != nil {
+		t.Fatal(err)
+	}
+
+	cmds := strings.Join(s.Commands(), "\n")
+	if !strings.Contains(cmds, "MAIL FROM:<from@example.com>\nRCPT TO:<to@example.com>\nRCPT TO:<bcc@example.com>\nDATA\n") {
+		t.Fatalf("unexpected commands:\n%s", cmds)
+	}
+	if msgs := s.Messages(); len(msgs) != 1 || msgs[0] != strings.Replace(string(raw), "\r\n", "\n", -1) {
+		t.Fatalf("unexpected messages: %q", msgs)
+	}
+
+	if err := SendRaw(s.Addr(), nil, "", []string{"to@example.com"}, raw, false); err != ErrMissingFrom {
+		t.Fatalf("expected ErrMissingFrom, got %v", err)
+	}
+}
+
+func TestClientReconnect(t *testing.T) {
+	s := newTestServer(t)
+	var mails int32
+	s.drop = func(cmd string) bool {
+		// close the first connection at the start of its second message
+		return strings.HasPrefix(cmd, "MAIL") && atomic.AddInt32(&mails, 1) == 2
+	}
+
+	m := NewMessage("Hi", "this is the body")
+	m.From = "from@example.com"
+	m.To = []string{"to@example.com"}
+
+	c := NewClient(s.Addr(), nil, false)
+	defer c.Close()
+	for i := 0; i < 2; i++ {
+		if err := c.Send(m); err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+	}
+	if n := len(s.Messages()); n != 2 {
+		t.Fatalf("expected 2 messages, got %d", n)
+	}
+
+	// a new connection is not retried
+	s = newTestServer(t)
+	s.drop = func(cmd string) bool { return strings.HasPrefix(cmd, "MAIL") }
+	c = NewClient(s.Addr(), nil, false)
+	if err := c.Send(m); err == nil {
+		t.Fatal("expected an error")
+	}
+	if n := len(s.Commands()); n != 2 {
+		t.Fatalf("unexpected commands: %q", s.Commands())
+	}
+}
+
+func TestClientStartTLSFailure(t *testing.T) {
+	s := newTestServer(t, "STARTTLS")
+	s.reply = func(cmd string) string {
+		if cmd == "STARTTLS" {
+			return "220 2.0.0 Ready to start TLS\r\nthis is not a TLS handshake"
+		}
+		return ""
+	}
+
+	err := VerifyConnection(s.Addr(), nil, false)
+	if err == nil || !strings.HasPrefix(err.Error(), "email: STARTTLS negotiation failed with 127.0.0.1: ") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, cmd := range s.Commands() {
+		if cmd == "QUIT" || strings.HasPrefix(cmd, "MAIL") {
+			t.Fatalf("%s sent after the failed STARTTLS", cmd)
+		}
+	}
+}
+
+func TestClientServerName(t *testing.T) {
+	s := newTestServer(t, "STARTTLS")
+	var sni string
+	s.tlsConfig = &tls.Config{
+		Certificates: []tls.Certificate{testCertificate(t, "smtp.corp.com")},
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			sni = hello.ServerName
+			return nil, nil
+		},
+	}
+
+	c := NewClient(s.Addr(), nil, false)
+	c.ServerName = "smtp.corp.com"
+	_, err := c.Capabilities()
+	var hostErr x509.HostnameError
+	if err == nil || errors.As(err, &hostErr) || !strings.Contains(err.Error(), "failed with smtp.corp.com: ") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sni != "smtp.corp.com" {
+		t.Fatalf("certificate requested for %q", sni)
+	}
+}
+
+func TestClientSenderFromAuth(t *testing.T) {
+	for _, auth := range []smtp.Auth{
+		smtp.PlainAuth("", "noreply@corp.com", "password", "127.0.0.1"),
+		LoginAuth("noreply@corp.com", "password", "127.0.0.1"),
+		smtp.CRAMMD5Auth("noreply@corp.com", "secret"),
+	} {
+		if user := authIdentity(auth, "127.0.0.1"); user != "noreply@corp.com" {
+			t.Fatalf("identity of %T: %q", auth, user)
+		}
+	}
+	if user := authIdentity(smtp.PlainAuth("", "noreply", "password", "127.0.0.1"), "127.0.0.1"); user != "" {
+		t.Fatalf("identity %q derived from a username that is not an address", user)
+	}
+
+	s := newTestServer(t, "AUTH PLAIN")
+	m := NewMessage("Hi", "this is the body")
+	m.From = "alice@corp.com"
+	m.To = []string{"to@example.com"}
+
+	c := NewClient(s.Addr(), smtp.PlainAuth("", "noreply@corp.com", "password", "127.0.0.1"), false)
+	defer c.Close()
+	c.SenderFromAuth = true
+	if err := c.Send(m); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(strings.Join(s.Commands(), "\n"), "MAIL FROM:<noreply@corp.com>") {
+		t.Fatalf("unexpected commands: %q", s.Commands())
+	}
+	msg := s.Messages()[0]
+	if !strings.Contains(msg, "From: alice@corp.com\nSender: noreply@corp.com\n") {
+		t.Fatalf("missing Sender:\n%s", msg)
+	}
+	if m.Sender != "" {
+		t.Fatal("message modified")
+	}
+
+	m.From = "Notifications <NoReply@corp.com>"
+	if err := c.Send(m); err != nil {
+		t.Fatal(err)
+	}
+	if msg := s.Messages()[1]; strings.Contains(msg, "Sender:") {
+		t.Fatalf("Sender added for the authenticated user:\n%s", msg)
+	}
+
+	m.From = "alice@corp.com"
+	m.DKIMSignature = "v=1; a=rsa-sha256; d=corp.com; s=sel; h=from:sender; bh=x; b=y"
+	if err := c.Send(m); err == nil {
+		t.Fatal("expected an error adding the Sender to a signed message")
+	}
+}
+
+func TestClientIsolateBcc(t *testing.T) {
+	s := newTestServer(t)
+
+	m := NewMessage("Hi", "this is the body")
+	m.From = "from@example.com"
+	m.To = []string{"to@example.com"}
+	m.Cc = []string{"cc@example.com"}
+	m.Bcc = []string{"bcc1@example.com", "bcc2@example.com"}
+
+	c := NewClient(s.Addr(), nil, false)
+	defer c.Close()
+	c.IsolateBcc = true
+	if err := c.Send(m); err != nil {
+		t.Fatal(err)
+	}
+
+	var transactions [][]string
+	for _, cmd := range s.Commands() {
+		switch {
+		case strings.HasPrefix(cmd, "MAIL"):
+			transactions = append(transactions, nil)
+		case strings.HasPrefix(cmd, "RCPT"):
+			i := len(transactions) - 1
+			transactions[i] = append(transactions[i], strings.TrimPrefix(cmd, "RCPT TO:"))
+		}
+	}
+	want := [][]string{
+		{"<to@example.com>", "<cc@example.com>"},
+		{"<bcc1@example.com>"},
+		{"<bcc2@example.com>"},
+	}
+	if len(transactions) != len(want) {
+		t.Fatalf("unexpected transactions %q", transactions)
+	}
+	for i := range want {
+		if strings.Join(transactions[i], ",") != strings.Join(want[i], ",") {
+			t.Fatalf("unexpected transactions %q", transactions)
+		}
+	}
+	for _, msg := range s.Messages() {
+		if strings.Contains(msg, "bcc") {
+			t.Fatalf("Bcc address in the message:\n%s", msg)
+		}
+	}
+}
+
+func TestClientPreflight(t *testing.T) {
+	s := newTestServer(t)
+	s.reply = func(cmd string) string {
+		if cmd == "RCPT TO:<bad@example.com>" {
+			return "550 5.1.1 No such user"
+		}
+		return ""
+	}
+
+	m := NewMessage("Hi", "this is the body")
+	m.From = "from@example.com"
+	m.To = []string{"to@example.com"}
+	m.IdempotencyKey = "1"
+
+	c := NewClient(s.Addr(), nil, false)
+	defer c.Close()
+	c.Preflight = true
+	c.Idempotency = NewMemoryStore(time.Hour)
+	if err := c.Send(m); err != nil {
+		t.Fatal(err)
+	}
+	m.Cc = []string{"bad@example.com"}
+	if err := c.Send(m); err == nil {
+		t.Fatal("expected an error for the rejected recipient")
+	}
+
+	want := []string{"MAIL FROM:<from@example.com>", "RCPT TO:<to@example.com>", "RSET",
+		"MAIL FROM:<from@example.com>", "RCPT TO:<to@example.com>", "RCPT TO:<bad@example.com>", "RSET"}
+	if cmds := s.Commands(); strings.Join(cmds[1:], "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected commands: %q", cmds)
+	}
+	if seen, _ := c.Idempotency.Seen("1"); seen {
+		t.Fatal("preflight recorded as sent")
+	}
+}
+
+type failingSource struct{}
+
+func (failingSource) Open() (io.ReadCloser, error) {
+	return ioutil.NopCloser(io.MultiReader(strings.NewReader(strings.Repeat("x", 10000)), iotest.ErrReader(errSourceGone))), nil
+}
+
+var errSourceGone = errors.New("file deleted")
+
+func TestClientAbortData(t *testing.T) {
+	s := newTestServer(t)
+
+	m := NewMessage("Hi", "this is the body")
+	m.From = "from@example.com"
+	m.To = []string{"to@example.com"}
+	m.AttachSource("a.txt", failingSource{}, false)
+
+	c := NewClient(s.Addr(), nil, false)
+	defer c.Close()
+	start := time.Now()
+	if err := c.Send(m); !errors.Is(err, errSourceGone) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("aborted after %v", d)
+	}
+
+	delete(m.Attachments, "a.txt")
+	if err := c.Send(m); err != nil {
+		t.Fatal(err)
+	}
+	if msgs := s.Messages(); len(msgs) != 1 || strings.Contains(msgs[0], "xxx") {
+		t.Fatalf("partial message delivered: %q", msgs)
+	}
+}
+
+func TestClientMaxRecipients(t *testing.T) {
+	s := newTestServer(t)
+
+	m := NewMessage("Hi", "this is the body")
+	m.From = "from@example.com"
+	m.To = []string{"to1@example.com", "to2@example.com"}
+	m.Bcc = []string{"bcc@example.com"}
+
+	c := NewClient(s.Addr(), nil, false)
+	defer c.Close()
+	c.MaxRecipients = 2
+	if err := c.Send(m); !errors.Is(err, ErrTooManyRecipients) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(s.Commands()) != 0 {
+		t.Fatalf("connected to the server: %q", s.Commands())
+	}
+
+	c.MaxRecipients = 3
+	if err := c.Send(m); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientRequireTLS(t *testing.T) {
+	cert := testCertificate(t, "127.0.0.1")
+	for _, ext := range [][]string{{"STARTTLS", "REQUIRETLS"}, {"STARTTLS"}, {"REQUIRETLS"}} {
+		s := newTestServer(t, ext...)
+		s.tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+
+		m := NewMessage("Hi", "this is the body")
+		m.From = "from@example.com"
+		m.To = []string{"to@example.com"}
+		m.RequireTLS = true
+		c := NewClient(s.Addr(), nil, true)
+		err := c.Send(m)
+		c.Close()
+
+		cmds := strings.Join(s.Commands(), "\n")
+		if len(ext) == 2 {
+			if err != nil || !strings.Contains(cmds, "MAIL FROM:<from@example.com> REQUIRETLS\n") {
+				t.Fatalf("unexpected commands: %v\n%s", err, cmds)
+			}
+			continue
+		}
+		if err == nil || strings.Contains(cmds, "MAIL") {
+			t.Fatalf("sent without REQUIRETLS support (%q): %v\n%s", ext, err, cmds)
+		}
+	}
+
+	m := NewMessage("Hi", "this is the body")
+	m.TLSOptional = true
+	if !strings.Contains(string(m.Headers()), "\r\nTLS-Required: No\r\n") {
+		t.Fatalf("missing TLS-Required:\n%s", m.Headers())
+	}
+	m.From = "from@example.com"
+	m.To = []string{"to@example.com"}
+	m.RequireTLS = true
+	if err := m.Validate(); err == nil {
+		t.Fatal("expected an error with RequireTLS and TLSOptional")
+	}
+}
+
+func TestClientTLSConnectionState(t *testing.T) {
+	s := newTestServer(t, "STARTTLS")
+	s.tlsConfig = &tls.Config{Certificates: []tls.Certificate{testCertificate(t, "127.0.0.1")}}
+
+	m := NewMessage("Hi", "this is the body")
+	m.From = "from@example.com"
+	m.To = []string{"to@example.com"}
+	c := NewClient(s.Addr(), nil, true)
+	defer c.Close()
+	if _, ok := c.TLSConnectionState(); ok {
+		t.Fatal("TLS state before connecting")
+	}
+	r, err := c.SendResult(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, ok := c.TLSConnectionState()
+	if !ok || !state.HandshakeComplete || state.Version < tls.VersionTLS12 || len(state.PeerCertificates) == 0 {
+		t.Fatalf("unexpected TLS state %+v", state)
+	}
+	if r.TLS == nil || r.TLS.CipherSuite != state.CipherSuite || r.TLS.PeerCertificates[0].Subject.CommonName != "127.0.0.1" {
+		t.Fatalf("unexpected TLS state of the result %+v", r.TLS)
+	}
+
+	plain := newTestServer(t)
+	c2 := NewClient(plain.Addr(), nil, false)
+	defer c2.Close()
+	if r, err := c2.SendResult(m); err != nil || r.TLS != nil {
+		t.Fatalf("unexpected TLS state without STARTTLS: %v", err)
+	}
+}
+
+func TestClientBanner(t *testing.T) {
+	s := newTestServer(t)
+	s.banner = "220-mx.example.com ESMTP Postfix (3.7.2)\r\n220 no UCE"
+
+	c := NewClient(s.Addr(), nil, false)
+	if c.Banner() != "" {
+		t.Fatal("banner before connecting")
+	}
+	if _, err := c.Capabilities(); err != nil {
+		t.Fatal(err)
+	}
+	if b := c.Banner(); b != "mx.example.com ESMTP Postfix (3.7.2)\nno UCE" {
+		t.Fatalf("unexpected banner %q", b)
+	}
+	c.Close()
+	if c.Banner() != "" {
+		t.Fatal("banner after closing")
+	}
+}
+
+func TestClientOnProgress(t *testing.T) {
+	s := newTestServer(t)
+	m := NewMessage("Hi", "this is the body")
+	m.From = "from@example.com"
+	m.To = []string{"to@example.com"}
+	m.Attachments["big.bin"] = &Attachment{Filename: "big.bin", Data: make([]byte, 200000)}
+
+	var calls int
+	var sum, written, total int64
+	c := NewClient(s.Addr(), nil, false)
+	c.OnProgress = func(bytesWritten, totalBytes int64) {
+		calls++
+		sum += bytesWritten - written
+		written, total = bytesWritten, totalBytes
+	}
+	if err := c.Send(m); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	msgs := s.Messages()
+	if len(msgs) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(msgs))
+	}
+	size := int64(len(strings.Replace(msgs[0], "\n", "\r\n", -1)))
+	if calls < 8 || sum != size || written != size || total != m.CurrentSize() {
+		t.Fatalf("%d calls summing %d of %d, %d written, message of %d bytes", calls, sum, total, written, size)
+	}
+	if total < size-1000 || total > size+1000 {
+		t.Fatalf("estimated %d bytes, message of %d bytes", total, size)
+	}
+
+	// the size of a BodyReader is estimated
+	m.BodyReader = strings.NewReader(strings.Repeat("hello world\r\n", 8000))
+	calls, sum, written, total = 0, 0, 0, 0
+	c = NewClient(s.Addr(), nil, false)
+	c.OnProgress = func(bytesWritten, totalBytes int64) {
+		written, total = bytesWritten, totalBytes
+	}
+	if err := c.Send(m); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	size = int64(len(strings.Replace(s.Messages()[1], "\n", "\r\n", -1)))
+	if written != size || total < size-1000 || total > size+1000 {
+		t.Fatalf("%d written of an estimated %d, message of %d bytes", written, total, size)
+	}
+}
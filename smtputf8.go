@@ -0,0 +1,173 @@
+package email
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+)
+
+// envelopeAddress returns the address of addr, without its display name,
+// for the MAIL and RCPT commands. If the server does not support SMTPUTF8
+// an internationalized domain is converted to ASCII, and a local part that
+// is not ASCII is an error as it can not be.
+func envelopeAddress(addr string, smtputf8 bool) (string, error) {
+	a, err := mail.ParseAddress(addr)
+	if err != nil {
+		return addr, nil
+	}
+	if smtputf8 || isPrintableASCII(a.Address) {
+		return a.Address, nil
+	}
+	return downgradeAddress(a.Address)
+}
+
+// downgradeHeaderAddress returns addr for a header of a message sent
+// without SMTPUTF8: its display name is encoded (RFC 2047) and its domain
+// converted to ASCII. It fails if the local part is not ASCII.
+func downgradeHeaderAddress(addr string) (string, error) {
+	a, err := mail.ParseAddress(addr)
+	if err != nil || isPrintableASCII(addr) {
+		return addr, nil
+	}
+	if a.Address, err = downgradeAddress(a.Address); err != nil {
+		return "", err
+	}
+	return a.String(), nil
+}
+
+// downgradeAddress converts the domain of the bare address addr to ASCII.
+func downgradeAddress(addr string) (string, error) {
+	i := strings.LastIndexByte(addr, '@')
+	if i < 0 || !isPrintableASCII(addr[:i]) {
+		return "", fmt.Errorf("email: %s needs SMTPUTF8, which the server does not support", addr)
+	}
+	return addr[:i+1] + domainToASCII(addr[i+1:]), nil
+}
+
+// downgradeHeaders returns m, or a copy of it with the addresses of its
+// headers downgraded for a server without SMTPUTF8.
+func (m *Message) downgradeHeaders() (*Message, error) {
+	ascii := isPrintableASCII(m.From+m.Sender+m.ReplyTo+m.ReadReceiptTo) && isPrintableASCII(strings.Join(m.To, "")+strings.Join(m.Cc, ""))
+	if ascii {
+		return m, nil
+	}
+
+	var err error
+	m = m.Clone()
+	for _, addr := range []*string{&m.From, &m.Sender, &m.ReplyTo, &m.ReadReceiptTo} {
+		if *addr, err = downgradeHeaderAddress(*addr); err != nil {
+			return nil, err
+		}
+	}
+	for _, list := range [][]string{m.To, m.Cc} {
+		for i := range list {
+			if list[i], err = downgradeHeaderAddress(list[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return m, nil
+}
+
+// domainToASCII converts the labels of domain that are not ASCII to
+// punycode (RFC 3492) with the "xn--" prefix, as in IDNA. The labels are
+// only lower cased, without the rest of the IDNA mapping.
+func domainToASCII(domain string) string {
+	labels := strings.Split(domain, ".")
+	for i, l := range labels {
+		if !isPrintableASCII(l) {
+			labels[i] = "xn--" + punycode(strings.ToLower(l))
+		}
+	}
+	return strings.Join(labels, ".")
+}
+
+// The parameters of punycode for IDNA, RFC 3492 section 5.
+const (
+	punyBase        = 36
+	punyTMin        = 1
+	punyTMax        = 26
+	punySkew        = 38
+	punyDamp        = 700
+	punyInitialBias = 72
+	punyInitialN    = 128
+)
+
+// punycode returns s encoded with the algorithm of RFC 3492 section 6.3.
+func punycode(s string) string {
+	runes := []rune(s)
+	var out []byte
+	for _, r := range runes {
+		if r < 0x80 {
+			out = append(out, byte(r))
+		}
+	}
+	b := len(out)
+	h := b
+	if b > 0 {
+		out = append(out, '-')
+	}
+
+	n, delta, bias := rune(punyInitialN), 0, punyInitialBias
+	for h < len(runes) {
+		m := rune(0x10ffff)
+		for _, r := range runes {
+			if r >= n && r < m {
+				m = r
+			}
+		}
+		delta += int(m-n) * (h + 1)
+		n = m
+		for _, r := range runes {
+			if r < n {
+				delta++
+			}
+			if r != n {
+				continue
+			}
+			q := delta
+			for k := punyBase; ; k += punyBase {
+				t := k - bias
+				if t < punyTMin {
+					t = punyTMin
+				} else if t > punyTMax {
+					t = punyTMax
+				}
+				if q < t {
+					break
+				}
+				out = append(out, punyDigit(t+(q-t)%(punyBase-t)))
+				q = (q - t) / (punyBase - t)
+			}
+			out = append(out, punyDigit(q))
+			bias = punyAdapt(delta, h+1, h == b)
+			delta = 0
+			h++
+		}
+		delta++
+		n++
+	}
+	return string(out)
+}
+
+func punyAdapt(delta, points int, first bool) int {
+	if first {
+		delta /= punyDamp
+	} else {
+		delta /= 2
+	}
+	delta += delta / points
+	k := 0
+	for delta > (punyBase-punyTMin)*punyTMax/2 {
+		delta /= punyBase - punyTMin
+		k += punyBase
+	}
+	return k + (punyBase-punyTMin+1)*delta/(delta+punySkew)
+}
+
+func punyDigit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
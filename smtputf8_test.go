@@ -0,0 +1,70 @@
+package email
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDomainToASCII(t *testing.T) {
+	for domain, want := range map[string]string{
+		"example.com":    "example.com",
+		"bücher.example": "xn--bcher-kva.example",
+		"München.de":     "xn--mnchen-3ya.de",
+		"例え.テスト":         "xn--r8jz45g.xn--zckzah",
+	} {
+		if got := domainToASCII(domain); got != want {
+			t.Errorf("domainToASCII(%q) = %q, want %q", domain, got, want)
+		}
+	}
+}
+
+func TestClientDowngradeSMTPUTF8(t *testing.T) {
+	s := newTestServer(t)
+
+	m := NewMessage("Hi", "this is the body")
+	m.From = "José <jose@example.com>"
+	m.To = []string{"Zoë <zoe@bücher.example>", "bob@example.com"}
+
+	c := NewClient(s.Addr(), nil, false)
+	defer c.Close()
+	if err := c.Send(m); err != nil {
+		t.Fatal(err)
+	}
+	cmds := strings.Join(s.Commands(), "\n")
+	if !strings.Contains(cmds, "MAIL FROM:<jose@example.com>\nRCPT TO:<zoe@xn--bcher-kva.example>\nRCPT TO:<bob@example.com>\n") {
+		t.Fatalf("unexpected commands:\n%s", cmds)
+	}
+	msg := s.Messages()[0]
+	if !strings.Contains(msg, "From: =?utf-8?q?Jos=C3=A9?= <jose@example.com>\n") ||
+		!strings.Contains(msg, "To: =?utf-8?q?Zo=C3=AB?= <zoe@xn--bcher-kva.example>,bob@example.com\n") {
+		t.Fatalf("unexpected headers:\n%s", msg)
+	}
+	if m.To[0] != "Zoë <zoe@bücher.example>" {
+		t.Fatal("message modified")
+	}
+
+	m.To = []string{"josé@example.com"}
+	if err := c.Send(m); err == nil || !strings.Contains(err.Error(), "needs SMTPUTF8") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := strings.Count(strings.Join(s.Commands(), "\n"), "MAIL FROM"); n != 1 {
+		t.Fatalf("transaction started for an address that can not be downgraded")
+	}
+}
+
+func TestClientSMTPUTF8(t *testing.T) {
+	s := newTestServer(t, "SMTPUTF8")
+
+	m := NewMessage("Hi", "this is the body")
+	m.From = "José <jose@example.com>"
+	m.To = []string{"josé@bücher.example"}
+	c := NewClient(s.Addr(), nil, false)
+	defer c.Close()
+	if err := c.Send(m); err != nil {
+		t.Fatal(err)
+	}
+	cmds := strings.Join(s.Commands(), "\n")
+	if !strings.Contains(cmds, "MAIL FROM:<jose@example.com> SMTPUTF8\nRCPT TO:<josé@bücher.example>\n") {
+		t.Fatalf("unexpected commands:\n%s", cmds)
+	}
+}
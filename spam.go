@@ -0,0 +1,49 @@
+package email
+
+import (
+	"fmt"
+	"net/textproto"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var spamScoreRe = regexp.MustCompile(`\b(score|required|hits)=(\S*?)(?:[\s,;]|$)`)
+
+// SetSpamHeader adds to ExtraHeaders the header name, which must start
+// with "X-Spam-", like X-Spam-Status or X-Spam-Score, with the result of a
+// spam scan done upstream, replacing any previous value. value is written
+// unaltered, so it may be folded but must not contain other line breaks.
+// The value of X-Spam-Score, and the score, required and hits fields of
+// X-Spam-Status, must be numbers.
+func (m *Message) SetSpamHeader(name, value string) error {
+	name = textproto.CanonicalMIMEHeaderKey(name)
+	if !strings.HasPrefix(name, "X-Spam-") || len(name) == len("X-Spam-") || strings.ContainsAny(name, ": \t\r\n") {
+		return fmt.Errorf("email: invalid spam header %q", name)
+	}
+	if strings.ContainsAny(strings.NewReplacer("\r\n ", "", "\r\n\t", "").Replace(value), "\r\n") {
+		return fmt.Errorf("email: invalid line break in %s", name)
+	}
+
+	switch name {
+	case "X-Spam-Score":
+		if _, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err != nil {
+			return fmt.Errorf("email: invalid %s %q", name, value)
+		}
+	case "X-Spam-Status":
+		for _, match := range spamScoreRe.FindAllStringSubmatch(value, -1) {
+			if _, err := strconv.ParseFloat(match[2], 64); err != nil {
+				return fmt.Errorf("email: invalid %s of %s: %q", match[1], name, match[2])
+			}
+		}
+	}
+
+	var h []Header
+	for _, e := range m.ExtraHeaders {
+		if textproto.CanonicalMIMEHeaderKey(e.Name) != name {
+			h = append(h, e)
+		}
+	}
+	m.ExtraHeaders = append(h, Header{Name: name, Value: value})
+	return nil
+}
@@ -0,0 +1,49 @@
+package email
+
+import (
+	"bytes"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func TestSetSpamHeader(t *testing.T) {
+	status := "No, score=-0.1 required=5.0 tests=DKIM_SIGNED,DKIM_VALID,\r\n\tSPF_PASS autolearn=ham autolearn_force=no version=3.4.6"
+	m := NewMessage("Hi", "this is the body")
+	for _, h := range [][2]string{
+		{"x-spam-status", "Yes, score=9 required=5.0"},
+		{"X-Spam-Status", status},
+		{"X-Spam-Score", "-0.1"},
+		{"X-Spam-Level", ""},
+		{"X-Spam-Flag", "NO"},
+	} {
+		if err := m.SetSpamHeader(h[0], h[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := "X-Spam-Status: " + status + "\r\nX-Spam-Score: -0.1\r\nX-Spam-Level: \r\nX-Spam-Flag: NO\r\n"
+	if h := string(m.Headers()); !strings.Contains(h, want) || strings.Count(h, "X-Spam-Status") != 1 {
+		t.Fatalf("unexpected spam headers:\n%s", h)
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(m.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := msg.Header.Get("X-Spam-Status"); s != strings.Replace(status, "\r\n\t", " ", 1) {
+		t.Fatalf("X-Spam-Status altered: %q", s)
+	}
+
+	for _, h := range [][2]string{
+		{"X-Spam", "Yes"},
+		{"X-Spam-", "Yes"},
+		{"X-Virus-Status", "Clean"},
+		{"X-Spam-Score", "high"},
+		{"X-Spam-Status", "Yes, score=high required=5.0"},
+		{"X-Spam-Flag", "YES\r\nBcc: eve@example.com"},
+	} {
+		if err := m.SetSpamHeader(h[0], h[1]); err == nil {
+			t.Fatalf("expected an error for %q", h)
+		}
+	}
+}
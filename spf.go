@@ -0,0 +1,91 @@
+package email
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// SPFResult is the result of an SPF check (RFC 7208) done by a relay.
+type SPFResult struct {
+	// Result is one of "pass", "fail", "softfail", "neutral", "none",
+	// "temperror" or "permerror".
+	Result string
+	// ClientIP is the IP address of the SMTP client that was checked.
+	ClientIP net.IP
+	// EnvelopeFrom is the MAIL FROM address, Helo the HELO or EHLO
+	// domain of the client.
+	EnvelopeFrom string
+	Helo         string
+	// Identity is the identity that was checked, "mailfrom" or "helo".
+	Identity string
+	// Receiver is the host name of the relay that did the check.
+	Receiver string
+	// Comment, if set, is written as a comment after the result, like
+	// "example.com: domain of alice@example.com designates 192.0.2.1 as
+	// permitted sender".
+	Comment string
+}
+
+var spfResults = []string{"pass", "fail", "softfail", "neutral", "none", "temperror", "permerror"}
+
+var dotAtomRe = regexp.MustCompile(`^[A-Za-z0-9!#$%&'*+/=?^_{|}~-]+(\.[A-Za-z0-9!#$%&'*+/=?^_{|}~-]+)*$`)
+
+// SetReceivedSPF prepends a Received-SPF header (RFC 7208) with the result
+// r to the trace headers.
+func (m *Message) SetReceivedSPF(r SPFResult) error {
+	if !contains(spfResults, r.Result) {
+		return fmt.Errorf("email: invalid SPF result %q", r.Result)
+	}
+	if r.Identity != "" && r.Identity != "mailfrom" && r.Identity != "helo" {
+		return fmt.Errorf("email: invalid SPF identity %q", r.Identity)
+	}
+	if strings.ContainsAny(r.Comment, "()\\\r\n") {
+		return fmt.Errorf("email: invalid SPF comment %q", r.Comment)
+	}
+
+	value := r.Result
+	if r.Comment != "" {
+		value += " (" + r.Comment + ")"
+	}
+	var params []string
+	for _, p := range []struct{ key, value string }{
+		{"receiver", r.Receiver},
+		{"client-ip", ipString(r.ClientIP)},
+		{"envelope-from", r.EnvelopeFrom},
+		{"helo", r.Helo},
+		{"identity", r.Identity},
+	} {
+		if p.value == "" {
+			continue
+		}
+		if strings.ContainsAny(p.value, "\r\n") {
+			return fmt.Errorf("email: invalid SPF %s %q", p.key, p.value)
+		}
+		params = append(params, p.key+"="+spfValue(p.value))
+	}
+	if len(params) > 0 {
+		value += "\r\n\t" + strings.Join(params, ";\r\n\t")
+	}
+
+	h := Header{Name: "Received-SPF", Value: value}
+	m.Trace = append([]Header{h}, m.Trace...)
+	return nil
+}
+
+func ipString(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
+
+// spfValue returns v as a dot-atom if possible, otherwise as a quoted
+// string.
+func spfValue(v string) string {
+	if dotAtomRe.MatchString(v) {
+		return v
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+}
@@ -0,0 +1,52 @@
+package email
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestSetReceivedSPF(t *testing.T) {
+	m := NewMessage("Hi", "this is the body")
+	err := m.SetReceivedSPF(SPFResult{
+		Result:       "pass",
+		ClientIP:     net.ParseIP("192.0.2.1"),
+		EnvelopeFrom: "alice@example.com",
+		Helo:         "mail.example.com",
+		Identity:     "mailfrom",
+		Receiver:     "relay.example.net",
+		Comment:      "relay.example.net: domain of alice@example.com designates 192.0.2.1 as permitted sender",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "Received-SPF: pass (relay.example.net: domain of alice@example.com designates 192.0.2.1 as permitted sender)\r\n" +
+		"\treceiver=relay.example.net;\r\n" +
+		"\tclient-ip=192.0.2.1;\r\n" +
+		"\tenvelope-from=\"alice@example.com\";\r\n" +
+		"\thelo=mail.example.com;\r\n" +
+		"\tidentity=mailfrom\r\n"
+	if h := string(m.Headers()); !strings.HasPrefix(h, want) {
+		t.Fatalf("unexpected Received-SPF header:\n%s", h)
+	}
+
+	m = NewMessage("Hi", "")
+	if err := m.SetReceivedSPF(SPFResult{Result: "softfail", ClientIP: net.ParseIP("2001:db8::1")}); err != nil {
+		t.Fatal(err)
+	}
+	if h := string(m.Headers()); !strings.HasPrefix(h, "Received-SPF: softfail\r\n\tclient-ip=\"2001:db8::1\"\r\n") {
+		t.Fatalf("unexpected Received-SPF header:\n%s", h)
+	}
+
+	for _, r := range []SPFResult{
+		{Result: "ok"},
+		{Result: "pass", Identity: "from"},
+		{Result: "pass", Comment: "a (b)"},
+		{Result: "pass", Helo: "a\r\nX: y"},
+	} {
+		if err := m.SetReceivedSPF(r); err == nil {
+			t.Fatalf("expected an error for %+v", r)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package email
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// spoolDir is the directory of the temporary files of AttachReader, the
+// default one of the system if empty. It is a variable so tests can
+// replace it.
+var spoolDir = ""
+
+// errSpoolRemoved is returned when writing an attachment whose spool file
+// was released with RemoveSpooled.
+var errSpoolRemoved = errors.New("email: spooled attachment removed")
+
+// spoolFile is a temporary file of AttachReader, removed when the last
+// message referencing it releases it.
+type spoolFile struct {
+	name string
+
+	mu   sync.Mutex
+	refs int
+}
+
+// spoolSource is the AttachmentSource of an attachment spooled by
+// AttachReader. Each message has its own spoolSource, a reference to the
+// shared spoolFile.
+type spoolSource struct {
+	file     *spoolFile
+	released bool
+}
+
+func (s *spoolSource) Open() (io.ReadCloser, error) {
+	if s.released {
+		return nil, errSpoolRemoved
+	}
+	return os.Open(s.file.name)
+}
+
+func (s *spoolSource) Size() (int64, error) {
+	if s.released {
+		return 0, errSpoolRemoved
+	}
+	return fileSource(s.file.name).Size()
+}
+
+// ref returns a new reference to the file of s.
+func (s *spoolSource) ref() *spoolSource {
+	s.file.mu.Lock()
+	defer s.file.mu.Unlock()
+	s.file.refs++
+	return &spoolSource{file: s.file}
+}
+
+// release releases the reference s, removing the file if it was the last
+// one.
+func (s *spoolSource) release() error {
+	if s.released {
+		return nil
+	}
+	s.released = true
+	s.file.mu.Lock()
+	defer s.file.mu.Unlock()
+	if s.file.refs--; s.file.refs > 0 {
+		return nil
+	}
+	if err := os.Remove(s.file.name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// AttachReader attaches the content read from r with the given filename.
+// The content is spooled to a temporary file that the attachment streams
+// from, so the memory used does not depend on its size.
+//
+// The message owns the file: call RemoveSpooled once done with it, like
+// after sending it with a Client. The package-level Send releases it
+// itself. Each Clone holds its own reference, so the file is
+// removed when the message and all its clones have called RemoveSpooled.
+// The file of an attachment replaced with another one of the same
+// filename is released at once.
+func (m *Message) AttachReader(filename string, r io.Reader, inline bool) error {
+	f, err := ioutil.TempFile(spoolDir, "email-spool-")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	m.AttachSource(filename, &spoolSource{file: &spoolFile{name: f.Name(), refs: 1}}, inline)
+	return nil
+}
+
+// RemoveSpooled releases the temporary files of the attachments added with
+// AttachReader, removing the ones that no clone of the message uses. The
+// message can not be written after that.
+func (m *Message) RemoveSpooled() error {
+	var err error
+	for _, a := range m.Attachments {
+		if src, ok := a.Source.(*spoolSource); ok {
+			if rerr := src.release(); rerr != nil && err == nil {
+				err = rerr
+			}
+		}
+	}
+	return err
+}
@@ -0,0 +1,134 @@
+package email
+
+import (
+	"io"
+	"io/ioutil"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func TestAttachReader(t *testing.T) {
+	defer func(dir string) { spoolDir = dir }(spoolDir)
+	spoolDir = t.TempDir()
+
+	const size = 16 << 20
+	m := NewMessage("Hi", "this is the body")
+	m.From = "from@example.com"
+	m.To = []string{"to@example.com"}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	if err := m.AttachReader("big.bin", io.LimitReader(zeroReader{}, size), false); err != nil {
+		t.Fatal(err)
+	}
+	n, err := m.WriteTo(ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runtime.ReadMemStats(&after)
+
+	if n < size*4/3 {
+		t.Fatalf("message of %d bytes for a %d bytes attachment", n, size)
+	}
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > size/4 {
+		t.Fatalf("%d bytes allocated for a %d bytes attachment", alloc, size)
+	}
+	if got := m.CurrentSize(); got < size*4/3 {
+		t.Fatalf("unexpected size %d of a spooled attachment", got)
+	}
+
+	files, _ := ioutil.ReadDir(spoolDir)
+	if len(files) != 1 || files[0].Size() != size {
+		t.Fatalf("unexpected spool files %v", files)
+	}
+	if err := m.RemoveSpooled(); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := ioutil.ReadDir(spoolDir); len(files) != 0 {
+		t.Fatalf("spool files not removed: %v", files)
+	}
+	if _, err := m.WriteTo(ioutil.Discard); err != errSpoolRemoved {
+		t.Fatalf("unexpected error writing a removed attachment: %v", err)
+	}
+}
+
+func TestAttachReaderSend(t *testing.T) {
+	defer func(dir string) { spoolDir = dir }(spoolDir)
+	spoolDir = t.TempDir()
+	spooled := func() int {
+		files, _ := ioutil.ReadDir(spoolDir)
+		return len(files)
+	}
+
+	m := NewMessage("Hi", "Crème brûlée")
+	m.From = "from@example.com"
+	m.To = []string{"a@example.com", "b@example.com", "c@example.com"}
+	if err := m.AttachReader("a.txt", strings.NewReader("old"), false); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AttachReader("a.txt", strings.NewReader("report"), false); err != nil {
+		t.Fatal(err)
+	}
+	if n := spooled(); n != 1 {
+		t.Fatalf("replaced spool file not removed: %d files", n)
+	}
+
+	// without 8BITMIME the message is sent as a copy
+	s := newTestServer(t)
+	c := NewClient(s.Addr(), nil, false)
+	defer c.Close()
+	if err := c.Send(m); err != nil {
+		t.Fatal(err)
+	}
+	if err := SendBatched(s.Addr(), nil, m, 1, false); err != nil {
+		t.Fatal(err)
+	}
+	clone := m.Clone()
+	if err := m.RemoveSpooled(); err != nil {
+		t.Fatal(err)
+	}
+	if n := spooled(); n != 1 {
+		t.Fatal("spool file removed while used by a clone")
+	}
+	if err := c.Send(clone); err != nil {
+		t.Fatal(err)
+	}
+	clone.RemoveSpooled()
+	if n := spooled(); n != 0 {
+		t.Fatalf("%d spool files left", n)
+	}
+
+	m = NewMessage("Hi", "Crème brûlée")
+	m.From = "from@example.com"
+	m.To = []string{"a@example.com"}
+	if err := m.AttachReader("a.txt", strings.NewReader("report"), false); err != nil {
+		t.Fatal(err)
+	}
+	if err := Send(s.Addr(), nil, m, false); err != nil {
+		t.Fatal(err)
+	}
+	if n := spooled(); n != 0 {
+		t.Fatalf("spool file left after Send: %d files", n)
+	}
+
+	msgs := s.Messages()
+	if len(msgs) != 6 {
+		t.Fatalf("expected 6 messages, got %d", len(msgs))
+	}
+	for _, msg := range msgs {
+		if !strings.Contains(msg, "cmVwb3J0\n") {
+			t.Fatalf("missing attachment in:\n%s", msg)
+		}
+	}
+}